@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jfrog/jfrog-client-go/utils/io/fileutils"
+	"github.com/spf13/afero"
 	flag "github.com/spf13/pflag"
 
 	"github.com/xenitab/gitops-promotion/pkg/config"
@@ -15,13 +16,17 @@ import (
 )
 
 const (
-	configFileName = "gitops-promotion.yaml"
+	configFileName         = "gitops-promotion.yaml"
+	lockFileName           = "gitops-promotion.lock"
+	githubAppPrivateKeyEnv = "GITHUB_APP_PRIVATE_KEY"
+	sshPassphraseEnv       = "SSH_PRIVATE_KEY_PASSPHRASE"
+	signingPassphraseEnv   = "SIGNING_KEY_PASSPHRASE"
 )
 
 //nolint:funlen,cyclop,gocognit // ignore
 func Run(ctx context.Context, args []string) (string, error) {
 	if len(args) < 2 {
-		return "", fmt.Errorf("new, feature, promote, or status subcommand is required")
+		return "", fmt.Errorf("new, feature, promote, status, lock, unlock, validate, schema or migrate-config subcommand is required")
 	}
 
 	// Global flags
@@ -34,17 +39,37 @@ func Run(ctx context.Context, args []string) (string, error) {
 	token := global.String("token", "", "Access token (PAT) to git provider")
 	providerType := global.String("provider", "azdo", "The git provider to use")
 	path := global.String("sourcedir", defaultPath, "Source working tree to operate on")
+	githubAPIURL := global.String("github-api-url", "", "GitHub REST API address, derived from the remote URL when not set")
+	githubGraphQLURL := global.String("github-graphql-url", "", "GitHub GraphQL API address, derived from the remote URL when not set")
+	githubAppID := global.Int64("github-app-id", 0, "GitHub App ID, authenticates as the app installation instead of with the token")
+	githubAppInstallationID := global.Int64("github-app-installation-id", 0, "GitHub App installation ID")
+	githubAppPrivateKey := global.String("github-app-private-key", "",
+		fmt.Sprintf("Path to the GitHub App private key, read from the %s environment variable when not set", githubAppPrivateKeyEnv))
+	sshPrivateKey := global.String("ssh-private-key", "",
+		"Path to an SSH private key used for git operations against SSH remotes, the token is still used for the provider API")
+	sshKnownHosts := global.String("ssh-known-hosts", "", "Path to a known_hosts file used to verify the host key of SSH remotes")
+	signingFormat := global.String("signing-format", "", "Format of the commit signing key, gpg or ssh, overrides the config file")
+	signingKey := global.String("signing-key", "", "Path to a key used to sign commits, overrides the config file")
+	remote := global.String("remote", "", "Name of the git remote, overrides the config file (default \"origin\")")
+	defaultBranch := global.String("default-branch", "",
+		"Branch that pull requests target, overrides the config file and is detected from the remote HEAD when not set")
 	err = global.Parse(args[2:])
 	if err != nil {
 		return "", err
 	}
 
-	// Load configuration
-	file, err := os.Open(filepath.Join(*path, configFileName))
-	if err != nil {
-		return "", err
+	// Commands that do not need the git repository
+	switch args[1] {
+	case "validate":
+		return ValidateCommand(afero.NewBasePathFs(afero.NewOsFs(), *path))
+	case "schema":
+		return SchemaCommand()
+	case "migrate-config":
+		return MigrateConfigCommand(afero.NewBasePathFs(afero.NewOsFs(), *path))
 	}
-	cfg, err := config.LoadConfig(file)
+
+	// Load configuration
+	cfg, err := config.LoadConfigFile(afero.NewOsFs(), filepath.Join(*path, configFileName))
 	if err != nil {
 		return "", fmt.Errorf("could not load config: %w", err)
 	}
@@ -64,7 +89,59 @@ func Run(ctx context.Context, args []string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	repo, err := git.LoadRepository(ctx, tmpPath, *providerType, *token)
+	providerOpts := git.ProviderOptions{
+		GitHubAPIURL:     *githubAPIURL,
+		GitHubGraphQLURL: *githubGraphQLURL,
+	}
+	if *githubAppID != 0 || *githubAppInstallationID != 0 {
+		privateKey, err := loadGitHubAppPrivateKey(*githubAppPrivateKey)
+		if err != nil {
+			return "", err
+		}
+		providerOpts.GitHubApp = &git.GitHubAppCredentials{
+			AppID:          *githubAppID,
+			InstallationID: *githubAppInstallationID,
+			PrivateKey:     privateKey,
+		}
+	}
+	if *remote != "" {
+		cfg.Remote = *remote
+	}
+	if *defaultBranch != "" {
+		cfg.DefaultBranch = *defaultBranch
+	}
+	repoOpts := git.RepositoryOptions{
+		Provider:      providerOpts,
+		Author:        git.Identity{Name: cfg.Commit.Author.Name, Email: cfg.Commit.Author.Email},
+		Committer:     git.Identity{Name: cfg.Commit.Committer.Name, Email: cfg.Commit.Committer.Email},
+		Remote:        cfg.Remote,
+		DefaultBranch: cfg.DefaultBranch,
+	}
+	if *sshPrivateKey != "" {
+		repoOpts.SSH = &git.SSHOptions{
+			PrivateKeyPath: *sshPrivateKey,
+			Passphrase:     os.Getenv(sshPassphraseEnv),
+			KnownHostsPath: *sshKnownHosts,
+		}
+	}
+	if *signingFormat != "" {
+		cfg.Signing.Format = config.SigningFormat(*signingFormat)
+	}
+	// A relative key in the config is relative to the source directory, like the config file itself
+	if cfg.Signing.Key != "" && !filepath.IsAbs(cfg.Signing.Key) {
+		cfg.Signing.Key = filepath.Join(*path, cfg.Signing.Key)
+	}
+	if *signingKey != "" {
+		cfg.Signing.Key = *signingKey
+	}
+	if cfg.Signing.Key != "" {
+		repoOpts.Signing = &git.SigningOptions{
+			Format:     git.SigningFormat(cfg.Signing.Format),
+			KeyPath:    cfg.Signing.Key,
+			Passphrase: os.Getenv(signingPassphraseEnv),
+		}
+	}
+	repo, err := git.LoadRepository(ctx, tmpPath, *providerType, *token, repoOpts)
 	if err != nil {
 		return "", fmt.Errorf("could not load %s repository: %w", *providerType, err)
 	}
@@ -77,11 +154,13 @@ func Run(ctx context.Context, args []string) (string, error) {
 		group := newCommand.String("group", "", "Main application group")
 		app := newCommand.String("app", "", "Name of the application")
 		tag := newCommand.String("tag", "", "Application version/tag to set")
+		digest := newCommand.String("digest", "", "Image digest to pin the tag to in all environments, e.g. sha256:...")
+		allowEmpty := newCommand.Bool("allow-empty", false, "Create the pull request even if no image is updated")
 		err := newCommand.Parse(args[2:])
 		if err != nil {
 			return "", err
 		}
-		return NewCommand(ctx, cfg, repo, *group, *app, *tag)
+		return NewCommand(ctx, cfg, repo, *group, *app, *tag, *digest, *allowEmpty)
 	case "feature":
 		featureCommand := flag.NewFlagSet(args[1], flag.ContinueOnError)
 		featureCommand.ParseErrorsWhitelist = flag.ParseErrorsWhitelist{UnknownFlags: true}
@@ -105,10 +184,60 @@ func Run(ctx context.Context, args []string) (string, error) {
 		}
 		return FeatureDeleteStaleCommand(ctx, cfg, repo, *maxAge)
 	case "promote":
-		return PromoteCommand(ctx, cfg, repo)
+		promoteCommand := flag.NewFlagSet(args[1], flag.ExitOnError)
+		promoteCommand.ParseErrorsWhitelist = flag.ParseErrorsWhitelist{UnknownFlags: true}
+		allowEmpty := promoteCommand.Bool("allow-empty", false, "Create the pull requests even if no image is updated")
+		err := promoteCommand.Parse(args[2:])
+		if err != nil {
+			return "", err
+		}
+		return PromoteCommand(ctx, cfg, repo, *allowEmpty)
 	case "status":
 		return StatusCommand(ctx, cfg, repo)
+	case "lock":
+		lockCommand := flag.NewFlagSet(args[1], flag.ExitOnError)
+		lockCommand.ParseErrorsWhitelist = flag.ParseErrorsWhitelist{UnknownFlags: true}
+		env := lockCommand.String("env", "", "Environment to lock")
+		reason := lockCommand.String("reason", "", "Reason for locking the environment")
+		until := lockCommand.String("until", "", "Time in RFC 3339 format when the lock expires, never expires when not set")
+		err := lockCommand.Parse(args[2:])
+		if err != nil {
+			return "", err
+		}
+		untilTime := time.Time{}
+		if *until != "" {
+			untilTime, err = time.Parse(time.RFC3339, *until)
+			if err != nil {
+				return "", fmt.Errorf("invalid until value: %w", err)
+			}
+		}
+		return LockCommand(ctx, cfg, repo, *env, *reason, untilTime)
+	case "unlock":
+		unlockCommand := flag.NewFlagSet(args[1], flag.ExitOnError)
+		unlockCommand.ParseErrorsWhitelist = flag.ParseErrorsWhitelist{UnknownFlags: true}
+		env := unlockCommand.String("env", "", "Environment to unlock")
+		err := unlockCommand.Parse(args[2:])
+		if err != nil {
+			return "", err
+		}
+		return UnlockCommand(ctx, cfg, repo, *env)
 	default:
 		return "", fmt.Errorf("Unknown command: %s", args[1])
 	}
 }
+
+// loadGitHubAppPrivateKey reads the private key from path, or from the environment if path is empty.
+func loadGitHubAppPrivateKey(path string) ([]byte, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read GitHub App private key: %w", err)
+		}
+		return b, nil
+	}
+	key := os.Getenv(githubAppPrivateKeyEnv)
+	if key == "" {
+		return nil, fmt.Errorf("GitHub App private key is required, set --github-app-private-key or %s", githubAppPrivateKeyEnv)
+	}
+	return []byte(key), nil
+}
@@ -25,6 +25,7 @@ func FeatureNewCommand(ctx context.Context, cfg config.Config, repo *git.Reposit
 	reg := regexp.MustCompile("[^a-zA-Z0-9-]+")
 	feature = reg.ReplaceAllString(feature, "")
 	feature = strings.ToLower(feature)
+	cfg = cfg.ForApp(group, app)
 	state := git.PRState{
 		Env:     cfg.Environments[0].Name,
 		Group:   group,
@@ -42,7 +43,7 @@ func FeatureNewCommand(ctx context.Context, cfg config.Config, repo *git.Reposit
 		return "", err
 	}
 	if featureOverwrite {
-		return promote(ctx, cfg, repo, &state)
+		return promote(ctx, cfg, repo, &state, false)
 	}
 
 	featureLabelSelector, err := cfg.GetFeatureLabelSelector(state.Group, app)
@@ -55,8 +56,7 @@ func FeatureNewCommand(ctx context.Context, cfg config.Config, repo *git.Reposit
 		return "", err
 	}
 	branchName := state.BranchName(false)
-	title := state.Title()
-	description, err := state.Description()
+	message, title, description, err := renderPullRequest(cfg, &state)
 	if err != nil {
 		return "", err
 	}
@@ -64,7 +64,7 @@ func FeatureNewCommand(ctx context.Context, cfg config.Config, repo *git.Reposit
 	if err != nil {
 		return "", fmt.Errorf("could not create branch: %w", err)
 	}
-	sha, err := repo.CreateCommit(branchName, title)
+	sha, err := repo.CreateCommit(branchName, message)
 	if err != nil {
 		return "", fmt.Errorf("could not commit changes: %w", err)
 	}
@@ -85,13 +85,13 @@ func FeatureNewCommand(ctx context.Context, cfg config.Config, repo *git.Reposit
 
 //nolint:gocognit,cyclop // ignore
 func FeatureDeleteStaleCommand(ctx context.Context, cfg config.Config, repo *git.Repository, maxAge time.Duration) (string, error) {
-	environmentName := cfg.Environments[0].Name
 	fs := afero.NewBasePathFs(afero.NewOsFs(), repo.GetRootDir())
 
 	// Find directory names that are feature deployments
 	states := []git.PRState{}
 	for groupKey, group := range cfg.Groups {
 		for appKey := range group.Applications {
+			environmentName := cfg.ForApp(groupKey, appKey).Environments[0].Name
 			globKey := fmt.Sprintf("%s-*", appKey)
 			matches, err := afero.Glob(fs, filepath.Join(groupKey, environmentName, globKey))
 			if err != nil {
@@ -121,6 +121,7 @@ func FeatureDeleteStaleCommand(ctx context.Context, cfg config.Config, repo *git
 
 	// Remove feature directories that have not been committed to for longer than max age
 	removedApplication := false
+	auto := true
 	//nolint:gocritic // ignore
 	for _, state := range states {
 		commit, err := repo.GetLastCommitForPath(state.AppPath())
@@ -135,6 +136,13 @@ func FeatureDeleteStaleCommand(ctx context.Context, cfg config.Config, repo *git
 			return "", fmt.Errorf("could not remove application: %w", err)
 		}
 		removedApplication = true
+
+		// The PR is only automatically merged if it is allowed in all affected environments
+		envAuto, err := cfg.ForApp(state.Group, state.App).IsEnvironmentAutomated(state.Env)
+		if err != nil {
+			return "", fmt.Errorf("could not get environment automation state: %w", err)
+		}
+		auto = auto && envAuto
 	}
 	if !removedApplication {
 		return "No stale application to remove, exiting early.", nil
@@ -156,10 +164,6 @@ func FeatureDeleteStaleCommand(ctx context.Context, cfg config.Config, repo *git
 	if err != nil {
 		return "", fmt.Errorf("could not push changes: %w", err)
 	}
-	auto, err := cfg.IsEnvironmentAutomated(environmentName)
-	if err != nil {
-		return "", fmt.Errorf("could not get environment automation state: %w", err)
-	}
 	prid, err := repo.CreatePR(ctx, branchName, auto, title, description)
 	if err != nil {
 		return "", fmt.Errorf("could not create a PR: %w", err)
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/xenitab/gitops-promotion/pkg/config"
+	"github.com/xenitab/gitops-promotion/pkg/git"
+)
+
+// LockCommand creates a PR that locks the environment, which stops automatic promotion to it until
+// it is unlocked or until the given time if it is not zero.
+func LockCommand(ctx context.Context, cfg config.Config, repo *git.Repository, env, reason string, until time.Time) (string, error) {
+	if !cfg.HasEnvironment(env) {
+		return "", fmt.Errorf("environment named %s does not exist", env)
+	}
+	locks, err := loadLocks(repo)
+	if err != nil {
+		return "", err
+	}
+	lock := config.Lock{Reason: reason}
+	if !until.IsZero() {
+		lock.Until = &until
+	}
+	locks[env] = lock
+	return updateLocks(ctx, repo, locks, fmt.Sprintf("lock/%s", env), fmt.Sprintf("Lock environment %s", env))
+}
+
+// UnlockCommand creates a PR that removes the lock of the environment.
+func UnlockCommand(ctx context.Context, cfg config.Config, repo *git.Repository, env string) (string, error) {
+	locks, err := loadLocks(repo)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := locks[env]; !ok {
+		return fmt.Sprintf("environment %s is not locked", env), nil
+	}
+	delete(locks, env)
+	return updateLocks(ctx, repo, locks, fmt.Sprintf("unlock/%s", env), fmt.Sprintf("Unlock environment %s", env))
+}
+
+func updateLocks(ctx context.Context, repo *git.Repository, locks config.Locks, branchName, title string) (string, error) {
+	b, err := yaml.Marshal(locks)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(repo.GetRootDir(), lockFileName), b, 0600)
+	if err != nil {
+		return "", fmt.Errorf("could not write lock file: %w", err)
+	}
+	err = repo.CreateBranch(branchName, true)
+	if err != nil {
+		return "", fmt.Errorf("could not create branch: %w", err)
+	}
+	sha, err := repo.CreateCommit(branchName, title)
+	if err != nil {
+		return "", fmt.Errorf("could not commit changes: %w", err)
+	}
+	err = repo.Push(branchName, true)
+	if err != nil {
+		return "", fmt.Errorf("could not push changes: %w", err)
+	}
+	prid, err := repo.CreatePR(ctx, branchName, true, title, "")
+	if err != nil {
+		return "", fmt.Errorf("could not create a PR: %w", err)
+	}
+	return fmt.Sprintf("created branch %s with pull request %d on commit %s", branchName, prid, sha), nil
+}
+
+// loadLocks reads the lock file in the repository working tree, a missing file means no locks.
+func loadLocks(repo *git.Repository) (config.Locks, error) {
+	b, err := os.ReadFile(filepath.Join(repo.GetRootDir(), lockFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return config.Locks{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	locks, err := config.LoadLocks(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", lockFileName, err)
+	}
+	return locks, nil
+}
+
+// loadDefaultBranchLocks reads the lock file on the head of the default branch, so that locks
+// added after a PR branch was created also apply to it.
+func loadDefaultBranchLocks(repo *git.Repository) (config.Locks, error) {
+	head, err := repo.FetchBranch(repo.GetDefaultBranch())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch new commits: %w", err)
+	}
+	b, err := repo.ReadFile(head, lockFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return config.Locks{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	locks, err := config.LoadLocks(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", lockFileName, err)
+	}
+	return locks, nil
+}
@@ -0,0 +1,34 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spf13/afero"
+
+	"github.com/xenitab/gitops-promotion/pkg/config"
+)
+
+// MigrateConfigCommand rewrites the config file to the latest apiVersion, keeping its comments.
+func MigrateConfigCommand(fs afero.Fs) (string, error) {
+	b, err := afero.ReadFile(fs, configFileName)
+	if err != nil {
+		return "", err
+	}
+	migrated, err := config.MigrateConfig(b)
+	if err != nil {
+		return "", fmt.Errorf("could not migrate %s: %w", configFileName, err)
+	}
+	if bytes.Equal(b, migrated) {
+		return fmt.Sprintf("%s is already at apiVersion %s", configFileName, config.APIVersion), nil
+	}
+	info, err := fs.Stat(configFileName)
+	if err != nil {
+		return "", err
+	}
+	err = afero.WriteFile(fs, configFileName, migrated, info.Mode())
+	if err != nil {
+		return "", fmt.Errorf("could not write %s: %w", configFileName, err)
+	}
+	return fmt.Sprintf("migrated %s to apiVersion %s", configFileName, config.APIVersion), nil
+}
@@ -3,25 +3,35 @@ package command
 import (
 	"context"
 	"fmt"
+	"regexp"
 
 	"github.com/xenitab/gitops-promotion/pkg/config"
 	"github.com/xenitab/gitops-promotion/pkg/git"
 )
 
+// digestRegexp matches image digests, which are a sha256 hash of the image manifest.
+var digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
 // NewCommand creates the initial PR which is going to be merged to the first environment. The main
-// difference to PromoteCommand is that it does not use a previous PR to create the first PR.
-func NewCommand(ctx context.Context, cfg config.Config, repo *git.Repository, group, app, tag string) (string, error) {
+// difference to PromoteCommand is that it does not use a previous PR to create the first PR. The
+// image is pinned to the digest in all environments if it is set.
+func NewCommand(ctx context.Context, cfg config.Config, repo *git.Repository, group, app, tag, digest string, allowEmpty bool) (string, error) {
+	if digest != "" && !digestRegexp.MatchString(digest) {
+		return "", fmt.Errorf("invalid digest %q, expected sha256: followed by 64 hexadecimal characters", digest)
+	}
+	cfg = cfg.ForApp(group, app)
 	headID, err := repo.GetCurrentCommit()
 	if err != nil {
 		return "", fmt.Errorf("could not get latest commit: %w", err)
 	}
 	state := git.PRState{
-		Group: group,
-		App:   app,
-		Tag:   tag,
-		Env:   cfg.Environments[0].Name,
-		Sha:   headID.String(),
-		Type:  git.PRTypePromote,
+		Group:  group,
+		App:    app,
+		Tag:    tag,
+		Digest: digest,
+		Env:    cfg.Environments[0].Name,
+		Sha:    headID.String(),
+		Type:   git.PRTypePromote,
 	}
-	return promote(ctx, cfg, repo, &state)
+	return promote(ctx, cfg, repo, &state, allowEmpty)
 }
@@ -2,8 +2,13 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
 
 	"github.com/xenitab/gitops-promotion/pkg/config"
 	"github.com/xenitab/gitops-promotion/pkg/git"
@@ -11,8 +16,8 @@ import (
 )
 
 // PromoteCommand is run after a PR is merged. It creates a new PR for the next environment
-// if there is one present.
-func PromoteCommand(ctx context.Context, cfg config.Config, repo *git.Repository) (string, error) {
+// if there is one present. Promotions that do not change any image fail unless allowEmpty is set.
+func PromoteCommand(ctx context.Context, cfg config.Config, repo *git.Repository, allowEmpty bool) (string, error) {
 	pr, err := repo.GetPRThatCausedCurrentCommit(ctx)
 	if err != nil {
 		//nolint:errcheck //best effort for logging
@@ -27,6 +32,7 @@ func PromoteCommand(ctx context.Context, cfg config.Config, repo *git.Repository
 	if pr.State.GetPRType() == git.PRTypeFeature {
 		return "skipping promotion of feature", nil
 	}
+	cfg = cfg.ForApp(pr.State.Group, pr.State.App)
 	if !cfg.HasNextEnvironment(pr.State.Env) {
 		return "no next environment to promote to", nil
 	}
@@ -34,33 +40,47 @@ func PromoteCommand(ctx context.Context, cfg config.Config, repo *git.Repository
 	if err != nil {
 		return "", fmt.Errorf("could not get latest commit: %w", err)
 	}
-	nextEnv, err := cfg.NextEnvironment(pr.State.Env)
-	if err != nil {
-		return "", fmt.Errorf("could not get next environment: %w", err)
-	}
-	state := &git.PRState{
-		Group: pr.State.Group,
-		App:   pr.State.App,
-		Tag:   pr.State.Tag,
-		Env:   nextEnv.Name,
-		Sha:   headID.String(),
-		Type:  pr.State.Type,
+
+	// Every next environment gets its own PR, starting from the same commit.
+	messages := []string{}
+	for _, nextEnv := range cfg.NextEnvironments(pr.State.Env) {
+		err := repo.ResetToHead()
+		if err != nil {
+			return "", fmt.Errorf("could not reset changes: %w", err)
+		}
+		state := &git.PRState{
+			Group:  pr.State.Group,
+			App:    pr.State.App,
+			Tag:    pr.State.Tag,
+			Digest: pr.State.Digest,
+			Env:    nextEnv.Name,
+			Sha:    headID.String(),
+			Type:   pr.State.Type,
+		}
+		message, err := promote(ctx, cfg, repo, state, allowEmpty)
+		if err != nil {
+			return "", fmt.Errorf("could not promote to %s: %w", nextEnv.Name, err)
+		}
+		messages = append(messages, message)
 	}
-	return promote(ctx, cfg, repo, state)
+	return strings.Join(messages, "\n"), nil
 }
 
-func promote(ctx context.Context, cfg config.Config, repo *git.Repository, state *git.PRState) (string, error) {
+func promote(ctx context.Context, cfg config.Config, repo *git.Repository, state *git.PRState, allowEmpty bool) (string, error) {
 	// Update image tag
-	manifestPath := fmt.Sprintf("%s/%s/%s", repo.GetRootDir(), state.Group, state.Env)
-	err := manifest.UpdateImageTag(manifestPath, state.App, state.Group, state.Tag)
+	fs := afero.NewBasePathFs(afero.NewOsFs(), repo.GetRootDir())
+	err := updateImage(fs, cfg, *state)
+	if allowEmpty && errors.Is(err, manifest.ErrNoImageUpdated) {
+		log.Printf("Creating an empty promotion: %v", err)
+		err = nil
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed updating manifests: %w", err)
 	}
 
 	// Push and create PR
 	branchName := state.BranchName(cfg.PRFlow == "per-env")
-	title := state.Title()
-	description, err := state.Description()
+	message, title, description, err := renderPullRequest(cfg, state)
 	if err != nil {
 		return "", err
 	}
@@ -68,7 +88,7 @@ func promote(ctx context.Context, cfg config.Config, repo *git.Repository, state
 	if err != nil {
 		return "", fmt.Errorf("could not create branch: %w", err)
 	}
-	sha, err := repo.CreateCommit(branchName, title)
+	sha, err := repo.CreateCommit(branchName, message)
 	if err != nil {
 		return "", fmt.Errorf("could not commit changes: %w", err)
 	}
@@ -80,9 +100,83 @@ func promote(ctx context.Context, cfg config.Config, repo *git.Repository, state
 	if err != nil {
 		return "", fmt.Errorf("could not get environment automation state: %w", err)
 	}
+	freeze, err := environmentFreeze(cfg, repo, state.Env)
+	if err != nil {
+		return "", err
+	}
+	if freeze != nil {
+		auto = false
+	}
 	prid, err := repo.CreatePR(ctx, branchName, auto, title, description)
 	if err != nil {
 		return "", fmt.Errorf("could not create a PR: %w", err)
 	}
+	if freeze != nil {
+		return fmt.Sprintf("created branch %s with pull request %d on commit %s without auto merge, environment %s is %s",
+			branchName, prid, sha, state.Env, freeze), nil
+	}
 	return fmt.Sprintf("created branch %s with pull request %d on commit %s", branchName, prid, sha), nil
 }
+
+// environmentFreeze returns the current freeze of the environment, or nil if it is not frozen.
+func environmentFreeze(cfg config.Config, repo *git.Repository, env string) (*config.Freeze, error) {
+	locks, err := loadLocks(repo)
+	if err != nil {
+		return nil, err
+	}
+	freeze, err := cfg.GetFreeze(env, locks, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("could not get environment freeze: %w", err)
+	}
+	return freeze, nil
+}
+
+// renderPullRequest renders the commit message, pull request title and pull request description
+// for the state with the templates in the config. The title is used as commit message and the
+// defaults of the state are used for anything that is not configured.
+func renderPullRequest(cfg config.Config, state *git.PRState) (message, title, description string, err error) {
+	title = state.Title()
+	if cfg.PullRequest.Title != "" {
+		title, err = state.Render(cfg.PullRequest.Title)
+		if err != nil {
+			return "", "", "", fmt.Errorf("could not render pull request title: %w", err)
+		}
+	}
+	message = title
+	if cfg.Commit.Message != "" {
+		message, err = state.Render(cfg.Commit.Message)
+		if err != nil {
+			return "", "", "", fmt.Errorf("could not render commit message: %w", err)
+		}
+	}
+	if cfg.PullRequest.Description == "" {
+		description, err = state.Description()
+		if err != nil {
+			return "", "", "", err
+		}
+		return message, title, description, nil
+	}
+	body, err := state.Render(cfg.PullRequest.Description)
+	if err != nil {
+		return "", "", "", fmt.Errorf("could not render pull request description: %w", err)
+	}
+	description, err = state.DescriptionWithBody(body)
+	if err != nil {
+		return "", "", "", err
+	}
+	return message, title, description, nil
+}
+
+// updateImage updates the image tag of the application in the manifests of the environment, either
+// in the HelmRelease configured for the application or in the fields marked with image policy setters.
+func updateImage(fs afero.Fs, cfg config.Config, state git.PRState) error {
+	helmRelease := cfg.GetHelmRelease(state.Group, state.App)
+	switch {
+	case helmRelease == nil:
+		return manifest.UpdateImageTag(fs, state)
+	case helmRelease.ValuesFile != "":
+		return manifest.UpdateHelmValuesFile(fs, state, helmRelease.ValuesFile, helmRelease.GetValuesPath())
+	default:
+		return manifest.UpdateHelmRelease(fs, state, helmRelease.Name, helmRelease.GetValuesPath())
+	}
+}
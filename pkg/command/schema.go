@@ -0,0 +1,16 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/xenitab/gitops-promotion/pkg/config"
+)
+
+// SchemaCommand returns the JSON Schema of the config file.
+func SchemaCommand() (string, error) {
+	b, err := config.Schema()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
@@ -10,9 +10,8 @@ import (
 	"github.com/xenitab/gitops-promotion/pkg/git"
 )
 
-// StatusCommand is run inside a PR to check if the PR can be merged.
-//
-//nolint:gocognit // not convinced that extracting bits would make it more readable
+// StatusCommand is run inside a PR to check if the PR can be merged. The previous environments
+// all have to be successfully reconciled.
 func StatusCommand(ctx context.Context, cfg config.Config, repo *git.Repository) (string, error) {
 	// If branch does not contain promote it was manual, return early
 	branchName, err := repo.GetBranchName()
@@ -32,41 +31,80 @@ func StatusCommand(ctx context.Context, cfg config.Config, repo *git.Repository)
 		return "Automatically allowing feature branch PR", nil
 	}
 
+	// Fail while the environment is frozen, the lock file can change after the PR is created
+	cfg = cfg.ForApp(pr.State.Group, pr.State.App)
+	locks, err := loadDefaultBranchLocks(repo)
+	if err != nil {
+		return "", err
+	}
+	freeze, err := cfg.GetFreeze(pr.State.Env, locks, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("could not get environment freeze: %w", err)
+	}
+	if freeze != nil {
+		return "", fmt.Errorf("environment %s %s", pr.State.Env, freeze)
+	}
+
 	// Skip the status check if this is the first environment
 	if cfg.Environments[0].Name == pr.State.Env {
 		return fmt.Sprintf("%q is the first environment so status check is skipped", pr.State.Env), nil
 	}
 
-	// Check status of commit
-	prevEnv, err := cfg.PrevEnvironment(pr.State.Env)
+	// Check status of commit for all previous environments
+	prevEnvs, err := cfg.PrevEnvironments(pr.State.Env)
 	if err != nil {
 		return "", err
 	}
-	deadline := time.Now().Add(cfg.StatusTimeout)
+	start := time.Now()
+	messages := []string{}
+	for _, prevEnv := range prevEnvs {
+		timeout, err := cfg.GetStatusTimeout(prevEnv.Name)
+		if err != nil {
+			return "", err
+		}
+		interval, err := cfg.GetStatusPollInterval(prevEnv.Name)
+		if err != nil {
+			return "", err
+		}
+		message, err := waitForStatus(ctx, repo, pr.State, prevEnv.Name, start.Add(timeout), interval)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, message)
+	}
+	return strings.Join(messages, "\n"), nil
+}
+
+// waitForStatus waits until there is a reconciliation status for the environment, either on the
+// commit that the PR was created from or on the head of the default branch. It checks for a status
+// every interval until the deadline.
+func waitForStatus(
+	ctx context.Context, repo *git.Repository, state *git.PRState, env string, deadline time.Time, interval time.Duration,
+) (string, error) {
 	for {
 		if time.Now().After(deadline) {
 			break
 		}
-		status, err := repo.GetStatus(ctx, pr.State.Sha, pr.State.Group, prevEnv.Name)
+		status, err := repo.GetStatus(ctx, state.Sha, state.Group, env)
 		if err == nil {
 			if !status.Succeeded {
-				return "", fmt.Errorf("failed reconciliation for %s-%s found on %q", pr.State.Group, prevEnv.Name, pr.State.Sha)
+				return "", fmt.Errorf("failed reconciliation for %s-%s found on %q", state.Group, env, state.Sha)
 			}
-			return fmt.Sprintf("successful reconciliation for %s-%s found on %q", pr.State.Group, prevEnv.Name, pr.State.Sha), nil
+			return fmt.Sprintf("successful reconciliation for %s-%s found on %q", state.Group, env, state.Sha), nil
 		}
-		head, err := repo.FetchBranch(git.DefaultBranch)
+		head, err := repo.FetchBranch(repo.GetDefaultBranch())
 		if err != nil {
 			return "", fmt.Errorf("failed to fetch new commits: %w", err)
 		}
-		status, err = repo.GetStatus(ctx, head.String(), pr.State.Group, prevEnv.Name)
+		status, err = repo.GetStatus(ctx, head.String(), state.Group, env)
 		if err == nil {
 			if !status.Succeeded {
-				return "", fmt.Errorf("failed reconciliation for %s-%s found on %s at %s", pr.State.Group, prevEnv.Name, git.DefaultBranch, head)
+				return "", fmt.Errorf("failed reconciliation for %s-%s found on %s at %s", state.Group, env, repo.GetDefaultBranch(), head)
 			}
-			return fmt.Sprintf("successful reconciliation for %s-%s found on %s at %s", pr.State.Group, prevEnv.Name, git.DefaultBranch, head), nil
+			return fmt.Sprintf("successful reconciliation for %s-%s found on %s at %s", state.Group, env, repo.GetDefaultBranch(), head), nil
 		}
-		fmt.Printf("retrying status check for %s-%s: %v\n", pr.State.Group, prevEnv.Name, err)
-		time.Sleep(5 * time.Second)
+		fmt.Printf("retrying status check for %s-%s: %v\n", state.Group, env, err)
+		time.Sleep(interval)
 	}
-	return "", fmt.Errorf("commit status check for %s-%s has timed out %q", pr.State.Group, prevEnv.Name, pr.State.Sha)
+	return "", fmt.Errorf("commit status check for %s-%s has timed out %q", state.Group, env, state.Sha)
 }
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+
+	"github.com/xenitab/gitops-promotion/pkg/config"
+	"github.com/xenitab/gitops-promotion/pkg/manifest"
+)
+
+// ValidateCommand validates the config and that the repository has a directory with a kustomization
+// for every environment of every group. All problems that are found are reported at once.
+func ValidateCommand(fs afero.Fs) (string, error) {
+	problems := config.ValidateConfig(fs, configFileName, func(cfg config.Config) []error {
+		return validateLayout(fs, cfg)
+	})
+	if len(problems) == 0 {
+		return fmt.Sprintf("%s is valid", configFileName), nil
+	}
+	lines := []string{}
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n"), fmt.Errorf("found %d problem(s) in %s", len(problems), configFileName)
+}
+
+// validateLayout checks that every group has a directory with a kustomization for its environments.
+func validateLayout(fs afero.Fs, cfg config.Config) []error {
+	errs := []error{}
+	for _, group := range cfg.GroupNames() {
+		checked := map[string]bool{}
+		for _, env := range cfg.ForGroup(group).Environments {
+			path := []string{"groups", group}
+			dir := filepath.Join(group, env.Name)
+			if checked[dir] {
+				continue
+			}
+			checked[dir] = true
+			exists, err := afero.DirExists(fs, dir)
+			if err != nil {
+				errs = append(errs, &config.ValidationError{Path: path, Err: err})
+				continue
+			}
+			if !exists {
+				errs = append(errs, &config.ValidationError{Path: path, Err: fmt.Errorf("directory %s does not exist", dir)})
+				continue
+			}
+			err = manifest.ValidateKustomization(fs, dir)
+			if err != nil {
+				errs = append(errs, &config.ValidationError{Path: path, Err: err})
+			}
+		}
+	}
+	return errs
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -15,79 +18,417 @@ const (
 	PRFlowTypePerEnv PRFlowType = "per-env"
 )
 
+type SigningFormat string
+
+const (
+	SigningFormatGPG SigningFormat = "gpg"
+	SigningFormatSSH SigningFormat = "ssh"
+)
+
+// App is an application in a group. The application is only promoted to the environments listed in
+// Environments if it is set, and not past the StopAt environment. Auto overrides whether PRs for
+// the application are merged automatically in each environment.
 type App struct {
 	FeatureOverwrite     bool              `yaml:"featureOverwrite"`
 	FeatureLabelSelector map[string]string `yaml:"featureLabelSelector"`
+	Environments         []string          `yaml:"environments"`
+	StopAt               string            `yaml:"stopAt"`
+	Auto                 map[string]bool   `yaml:"auto"`
+	HelmRelease          *HelmRelease      `yaml:"helmRelease"`
 }
 
+// HelmRelease configures an application deployed with a Flux HelmRelease whose image tag is set in
+// its values instead of in a field marked with an image policy setter. The tag is set at ValuesPath
+// in the values of the HelmRelease called Name, or in ValuesFile if the values are read from a file,
+// e.g. one generated into a ConfigMap. ValuesFile is relative to the environment directory.
+type HelmRelease struct {
+	Name       string `yaml:"name"`
+	ValuesPath string `yaml:"valuesPath"`
+	ValuesFile string `yaml:"valuesFile"`
+}
+
+// DefaultHelmValuesPath is the path of the image tag in the values of a HelmRelease.
+const DefaultHelmValuesPath = "image.tag"
+
+// GetValuesPath returns the fields of the path to the image tag in the values.
+func (h HelmRelease) GetValuesPath() []string {
+	if h.ValuesPath == "" {
+		return strings.Split(DefaultHelmValuesPath, ".")
+	}
+	return strings.Split(h.ValuesPath, ".")
+}
+
+// Group is a set of applications that are promoted together. Environments and StatusTimeout
+// override the global values for the group when they are set.
 type Group struct {
-	Applications map[string]App `yaml:"applications"`
+	Applications  map[string]App `yaml:"applications"`
+	Environments  []Environment  `yaml:"environments"`
+	StatusTimeout Duration       `yaml:"status_timeout_minutes"`
 }
 
+// Environment is a step in the promotion graph. It is promoted to after all environments listed in
+// After, or after the previous environment in the list if After is empty. StatusTimeout and
+// StatusPollInterval override the global values when waiting for the environment to reconcile.
+// Pull requests to the environment are not merged automatically during its Freeze windows.
 type Environment struct {
-	Name      string `yaml:"name"`
-	Automated bool   `yaml:"auto"`
+	Name               string         `yaml:"name"`
+	Automated          bool           `yaml:"auto"`
+	After              []string       `yaml:"after"`
+	StatusTimeout      Duration       `yaml:"status_timeout_minutes"`
+	StatusPollInterval Interval       `yaml:"status_poll_interval"`
+	Freeze             []FreezeWindow `yaml:"freeze"`
+}
+
+// Signing configures signing of the commits created by gitops-promotion. Key is the path to
+// an armored GPG private key or an SSH private key, depending on the format.
+type Signing struct {
+	Format SigningFormat `yaml:"format"`
+	Key    string        `yaml:"key"`
+}
+
+type Identity struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email"`
+}
+
+// Commit configures the commits created by gitops-promotion. Message is a Go template rendered
+// with the pull request state, the pull request title is used when it is empty.
+type Commit struct {
+	Author    Identity `yaml:"author"`
+	Committer Identity `yaml:"committer"`
+	Message   string   `yaml:"message"`
+}
+
+// PullRequest configures Go templates for the title and description of pull requests, rendered
+// with the pull request state.
+type PullRequest struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
 }
 
 type Config struct {
-	PRFlow        PRFlowType       `yaml:"prflow"`
-	StatusTimeout time.Duration    `yaml:"status_timeout_minutes"`
-	Environments  []Environment    `yaml:"environments"`
-	Groups        map[string]Group `yaml:"groups"`
+	APIVersion         string           `yaml:"apiVersion"`
+	PRFlow             PRFlowType       `yaml:"prflow"`
+	StatusTimeout      Duration         `yaml:"status_timeout_minutes"`
+	StatusPollInterval Interval         `yaml:"status_poll_interval"`
+	Environments       []Environment    `yaml:"environments"`
+	Groups             map[string]Group `yaml:"groups"`
+	Signing            Signing          `yaml:"signing"`
+	Commit             Commit           `yaml:"commit"`
+	PullRequest        PullRequest      `yaml:"pullRequest"`
+	Remote             string           `yaml:"remote"`
+	DefaultBranch      string           `yaml:"defaultBranch"`
+	Include            []string         `yaml:"include"`
+}
+
+// Duration is a duration in the config. Plain numbers are minutes, anything else is parsed as a
+// Go duration, e.g. 90s or 1h30m.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+	if minutes, err := strconv.ParseFloat(value, 64); err == nil {
+		d.Duration = time.Duration(minutes * float64(time.Minute))
+	} else {
+		d.Duration, err = time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected minutes or a duration like 10m", value)
+		}
+	}
+	if d.Duration < 0 {
+		return fmt.Errorf("invalid duration %q, cannot be negative", value)
+	}
+	return nil
+}
+
+// Interval is a duration in the config that has to have a unit, e.g. 5s or 1m. Plain numbers are
+// rejected instead of being read as minutes like in Duration, as intervals are usually seconds.
+type Interval struct {
+	time.Duration
+}
+
+func (i *Interval) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+	i.Duration, err = time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid interval %q, expected a duration with a unit like 5s", value)
+	}
+	if i.Duration < 0 {
+		return fmt.Errorf("invalid interval %q, cannot be negative", value)
+	}
+	return nil
 }
 
 func LoadConfig(file io.Reader) (Config, error) {
-	cfg := Config{}
-	decoder := yaml.NewDecoder(file)
-	err := decoder.Decode(&cfg)
+	cfg, err := decodeConfig(file)
 	if err != nil {
 		return Config{}, err
 	}
+	if len(cfg.Include) > 0 {
+		return Config{}, fmt.Errorf("include is only supported when loading the config from a file")
+	}
+	errs := validateConfig(cfg)
+	if len(errs) > 0 {
+		return Config{}, errs[0]
+	}
+	return cfg, nil
+}
 
-	if len(cfg.Environments) == 0 {
-		return Config{}, fmt.Errorf("environments list cannot be empty")
+// decodeConfig decodes the config and sets default values. Unknown and duplicate keys are errors.
+func decodeConfig(file io.Reader) (Config, error) {
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return Config{}, err
 	}
+	version, err := configVersion(b)
+	if err != nil {
+		return Config{}, err
+	}
+	// Older versions are upgraded in memory, the file is only rewritten by MigrateConfig
+	if needsMigration(version) {
+		b, err = migrateConfig(b, version)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	cfg := Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.SetStrict(true)
+	err = decoder.Decode(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.APIVersion = latestVersion()
 	if cfg.PRFlow == "" {
 		cfg.PRFlow = PRFlowTypePerApp
 	}
-	if cfg.StatusTimeout.String() == (0 * time.Minute).String() {
-		cfg.StatusTimeout = 5 * time.Minute
+	if cfg.StatusTimeout.Duration == 0 {
+		cfg.StatusTimeout.Duration = 5 * time.Minute
 	}
-	switch cfg.PRFlow {
-	case PRFlowTypePerApp, PRFlowTypePerEnv:
-		break
-	default:
-		return Config{}, fmt.Errorf("invalid prflow value: %s", cfg.PRFlow)
+	if cfg.StatusPollInterval.Duration == 0 {
+		cfg.StatusPollInterval.Duration = 5 * time.Second
+	}
+	if cfg.Signing.Format == "" {
+		cfg.Signing.Format = SigningFormatGPG
 	}
-
 	return cfg, nil
 }
 
+// GroupNames returns the names of the configured groups in sorted order.
+func (c Config) GroupNames() []string {
+	return sortedGroupNames(c.Groups)
+}
+
+// ForGroup returns the config with the environments and status timeout of the group resolved.
+// The config is returned as is for groups that do not override them or are not configured.
+func (c Config) ForGroup(name string) Config {
+	group, ok := c.Groups[name]
+	if !ok {
+		return c
+	}
+	if len(group.Environments) > 0 {
+		c.Environments = group.Environments
+	}
+	if group.StatusTimeout.Duration != 0 {
+		c.StatusTimeout = group.StatusTimeout
+	}
+	return c
+}
+
+// ForApp returns the config with the environments of the group resolved and the policy of the
+// application applied. Environments that are skipped by the application are removed from the
+// promotion graph, so that their next environments are promoted to after their previous ones.
+func (c Config) ForApp(group, app string) Config {
+	c = c.ForGroup(group)
+	appObj, ok := c.Groups[group].Applications[app]
+	if !ok {
+		return c
+	}
+
+	removed := c.skippedEnvironmentNames(appObj)
+	envs := []Environment{}
+	for _, e := range c.Environments {
+		if removed[e.Name] {
+			continue
+		}
+		e.After = nil
+		if len(envs) > 0 {
+			e.After = c.keptPrevEnvironmentNames(e.Name, removed)
+		}
+		if auto, ok := appObj.Auto[e.Name]; ok {
+			e.Automated = auto
+		}
+		envs = append(envs, e)
+	}
+	c.Environments = envs
+	return c
+}
+
+// skippedEnvironmentNames returns the names of the environments that the application is not
+// promoted to.
+func (c Config) skippedEnvironmentNames(app App) map[string]bool {
+	skipped := map[string]bool{}
+	if app.StopAt != "" {
+		for _, name := range c.descendantEnvironmentNames(app.StopAt) {
+			skipped[name] = true
+		}
+	}
+	if len(app.Environments) == 0 {
+		return skipped
+	}
+	allowed := map[string]bool{}
+	for _, name := range app.Environments {
+		allowed[name] = true
+	}
+	for _, e := range c.Environments {
+		if !allowed[e.Name] {
+			skipped[e.Name] = true
+		}
+	}
+	return skipped
+}
+
+// descendantEnvironmentNames returns the names of all environments that are promoted to after the
+// named environment, directly or through other environments.
+func (c Config) descendantEnvironmentNames(name string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		for _, e := range c.NextEnvironments(queue[0]) {
+			if !seen[e.Name] {
+				seen[e.Name] = true
+				names = append(names, e.Name)
+				queue = append(queue, e.Name)
+			}
+		}
+		queue = queue[1:]
+	}
+	return names
+}
+
+// appRootEnvironmentNames returns the environments of the application that have no previous
+// environment once the environments it skips are removed.
+func (c Config) appRootEnvironmentNames(app App) []string {
+	removed := c.skippedEnvironmentNames(app)
+	names := []string{}
+	for _, e := range c.Environments {
+		if !removed[e.Name] && len(c.keptPrevEnvironmentNames(e.Name, removed)) == 0 {
+			names = append(names, e.Name)
+		}
+	}
+	return names
+}
+
+// keptPrevEnvironmentNames returns the previous environments of the named environment, replacing
+// removed environments with their previous environments.
+func (c Config) keptPrevEnvironmentNames(name string, removed map[string]bool) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	var visit func(string)
+	visit = func(name string) {
+		for _, prev := range c.prevEnvironmentNames(name) {
+			if removed[prev] {
+				visit(prev)
+				continue
+			}
+			if !seen[prev] {
+				seen[prev] = true
+				names = append(names, prev)
+			}
+		}
+	}
+	visit(name)
+	return names
+}
+
 func (c Config) HasNextEnvironment(name string) bool {
-	last := len(c.Environments) - 1
-	return c.Environments[last].Name != name
+	return len(c.NextEnvironments(name)) > 0
 }
 
+// NextEnvironment returns the only environment that is promoted to after the named environment.
 func (c Config) NextEnvironment(name string) (Environment, error) {
-	_, i, err := c.getEnvironment(name)
+	_, _, err := c.getEnvironment(name)
 	if err != nil {
 		return Environment{}, err
 	}
-	if i == len(c.Environments)-1 {
+	next := c.NextEnvironments(name)
+	switch len(next) {
+	case 0:
 		return Environment{}, fmt.Errorf("last environment cannot have a next environment")
+	case 1:
+		return next[0], nil
+	default:
+		return Environment{}, fmt.Errorf("environment %s has more than one next environment", name)
+	}
+}
+
+// NextEnvironments returns all environments that are promoted to after the named environment,
+// in the order that they are declared.
+func (c Config) NextEnvironments(name string) []Environment {
+	next := []Environment{}
+	for _, e := range c.Environments {
+		for _, prev := range c.prevEnvironmentNames(e.Name) {
+			if prev == name {
+				next = append(next, e)
+			}
+		}
 	}
-	return c.Environments[i+1], nil
+	return next
 }
 
+// PrevEnvironment returns the only environment that the named environment is promoted from.
 func (c Config) PrevEnvironment(name string) (Environment, error) {
-	_, i, err := c.getEnvironment(name)
+	prev, err := c.PrevEnvironments(name)
 	if err != nil {
 		return Environment{}, err
 	}
-	if i == 0 {
+	switch len(prev) {
+	case 0:
 		return Environment{}, fmt.Errorf("first environment cannot have a previous environment")
+	case 1:
+		return prev[0], nil
+	default:
+		return Environment{}, fmt.Errorf("environment %s has more than one previous environment", name)
 	}
-	return c.Environments[i-1], nil
+}
+
+// PrevEnvironments returns all environments that the named environment is promoted from.
+func (c Config) PrevEnvironments(name string) ([]Environment, error) {
+	_, _, err := c.getEnvironment(name)
+	if err != nil {
+		return nil, err
+	}
+	prev := []Environment{}
+	for _, prevName := range c.prevEnvironmentNames(name) {
+		e, _, err := c.getEnvironment(prevName)
+		if err != nil {
+			return nil, err
+		}
+		prev = append(prev, e)
+	}
+	return prev, nil
+}
+
+func (c Config) prevEnvironmentNames(name string) []string {
+	e, i, err := c.getEnvironment(name)
+	if err != nil || i == 0 {
+		return nil
+	}
+	if len(e.After) > 0 {
+		return e.After
+	}
+	return []string{c.Environments[i-1].Name}
 }
 
 func (c Config) IsEnvironmentAutomated(name string) (bool, error) {
@@ -98,6 +439,43 @@ func (c Config) IsEnvironmentAutomated(name string) (bool, error) {
 	return e.Automated, nil
 }
 
+// HasEnvironment returns true if the environment is used by any group.
+func (c Config) HasEnvironment(name string) bool {
+	if _, _, err := c.getEnvironment(name); err == nil {
+		return true
+	}
+	for _, group := range c.GroupNames() {
+		if _, _, err := c.ForGroup(group).getEnvironment(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStatusTimeout returns how long to wait for the environment to reconcile.
+func (c Config) GetStatusTimeout(name string) (time.Duration, error) {
+	e, _, err := c.getEnvironment(name)
+	if err != nil {
+		return 0, err
+	}
+	if e.StatusTimeout.Duration != 0 {
+		return e.StatusTimeout.Duration, nil
+	}
+	return c.StatusTimeout.Duration, nil
+}
+
+// GetStatusPollInterval returns how often to check if the environment has reconciled.
+func (c Config) GetStatusPollInterval(name string) (time.Duration, error) {
+	e, _, err := c.getEnvironment(name)
+	if err != nil {
+		return 0, err
+	}
+	if e.StatusPollInterval.Duration != 0 {
+		return e.StatusPollInterval.Duration, nil
+	}
+	return c.StatusPollInterval.Duration, nil
+}
+
 func (c Config) IsAnyEnvironmentManual() bool {
 	for _, e := range c.Environments {
 		if !e.Automated {
@@ -131,6 +509,12 @@ func (c Config) GetFeatureLabelSelector(group, app string) (map[string]string, e
 	return appObj.FeatureLabelSelector, nil
 }
 
+// GetHelmRelease returns the HelmRelease of the application, or nil if its image tag is updated with
+// image policy setters.
+func (c Config) GetHelmRelease(group, app string) *HelmRelease {
+	return c.Groups[group].Applications[app].HelmRelease
+}
+
 func (c Config) getEnvironment(name string) (Environment, int, error) {
 	for i, e := range c.Environments {
 		if e.Name == name {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 	"time"
 
@@ -127,6 +128,140 @@ func TestConfigNextPrev(t *testing.T) {
 	}
 }
 
+const graphData = `
+prflow: per-env
+environments:
+  - name: dev
+    auto: true
+  - name: staging
+    auto: true
+  - name: prod-eu
+    after: [staging]
+  - name: prod-us
+    after: [staging]
+  - name: prod-asia
+    after: [staging]
+  - name: verify
+    after: [prod-eu, prod-us, prod-asia]
+`
+
+func TestConfigGraph(t *testing.T) {
+	reader := bytes.NewReader([]byte(graphData))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+	names := func(envs []Environment) []string {
+		result := []string{}
+		for _, e := range envs {
+			result = append(result, e.Name)
+		}
+		return result
+	}
+	cases := []struct {
+		environment      string
+		nextEnvironments []string
+		prevEnvironments []string
+	}{
+		{
+			environment:      "dev",
+			nextEnvironments: []string{"staging"},
+			prevEnvironments: []string{},
+		},
+		{
+			environment:      "staging",
+			nextEnvironments: []string{"prod-eu", "prod-us", "prod-asia"},
+			prevEnvironments: []string{"dev"},
+		},
+		{
+			environment:      "prod-us",
+			nextEnvironments: []string{"verify"},
+			prevEnvironments: []string{"staging"},
+		},
+		{
+			environment:      "verify",
+			nextEnvironments: []string{},
+			prevEnvironments: []string{"prod-eu", "prod-us", "prod-asia"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.environment, func(t *testing.T) {
+			require.Equal(t, c.nextEnvironments, names(cfg.NextEnvironments(c.environment)))
+			require.Equal(t, len(c.nextEnvironments) > 0, cfg.HasNextEnvironment(c.environment))
+			prev, err := cfg.PrevEnvironments(c.environment)
+			require.NoError(t, err)
+			require.Equal(t, c.prevEnvironments, names(prev))
+		})
+	}
+
+	_, err = cfg.NextEnvironment("staging")
+	require.EqualError(t, err, "environment staging has more than one next environment")
+	_, err = cfg.PrevEnvironment("verify")
+	require.EqualError(t, err, "environment verify has more than one previous environment")
+	_, err = cfg.PrevEnvironments("foobar")
+	require.EqualError(t, err, "environment named foobar does not exist")
+}
+
+func TestConfigGraphInvalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		expectedErr string
+	}{
+		{
+			name: "first environment after other",
+			data: `
+    prflow: per-env
+    environments:
+      - name: dev
+        after: [prod]
+      - name: prod
+  `,
+			expectedErr: "first environment dev cannot be after other environments",
+		},
+		{
+			name: "unknown environment",
+			data: `
+    prflow: per-env
+    environments:
+      - name: dev
+      - name: prod
+        after: [qa]
+  `,
+			expectedErr: "environment prod is after qa which is not declared before it",
+		},
+		{
+			name: "cycle",
+			data: `
+    prflow: per-env
+    environments:
+      - name: dev
+      - name: qa
+        after: [prod]
+      - name: prod
+        after: [qa]
+  `,
+			expectedErr: "environment qa is after prod which is not declared before it",
+		},
+		{
+			name: "fan-out with per-app",
+			data: `
+    environments:
+      - name: dev
+      - name: prod-eu
+        after: [dev]
+      - name: prod-us
+        after: [dev]
+  `,
+			expectedErr: "environment dev has more than one next environment, which requires prflow per-env",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadConfig(bytes.NewReader([]byte(c.data)))
+			require.EqualError(t, err, c.expectedErr)
+		})
+	}
+}
+
 func TestConfigNotFound(t *testing.T) {
 	reader := bytes.NewReader([]byte(simpleData))
 	cfg, err := LoadConfig(reader)
@@ -173,6 +308,114 @@ func TestConfigPRFlowInvalid(t *testing.T) {
 	require.EqualError(t, err, "invalid prflow value: foobar")
 }
 
+func TestConfigSigning(t *testing.T) {
+	data := `
+    environments:
+      - name: dev
+        auto: true
+    signing:
+      format: ssh
+      key: /path/to/key
+  `
+	reader := bytes.NewReader([]byte(data))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+	require.Equal(t, Signing{Format: SigningFormatSSH, Key: "/path/to/key"}, cfg.Signing)
+
+	reader = bytes.NewReader([]byte(simpleData))
+	cfg, err = LoadConfig(reader)
+	require.NoError(t, err)
+	require.Equal(t, Signing{Format: SigningFormatGPG}, cfg.Signing)
+}
+
+func TestConfigSigningInvalid(t *testing.T) {
+	data := `
+    environments:
+      - name: dev
+        auto: true
+    signing:
+      format: x509
+  `
+	reader := bytes.NewReader([]byte(data))
+	_, err := LoadConfig(reader)
+	require.EqualError(t, err, "invalid signing format value: x509")
+}
+
+func TestConfigCommit(t *testing.T) {
+	data := `
+    environments:
+      - name: dev
+        auto: true
+    commit:
+      author:
+        name: Promotion Bot
+        email: bot@example.com
+      message: "chore({{ .Group }}): promote {{ .App }} to {{ .Env }}"
+    pullRequest:
+      title: "chore({{ .Group }}): promote {{ .App }} to {{ .Env }}"
+      description: "Refs {{ .Tag }}"
+  `
+	reader := bytes.NewReader([]byte(data))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+	require.Equal(t, Identity{Name: "Promotion Bot", Email: "bot@example.com"}, cfg.Commit.Author)
+	require.Equal(t, Identity{}, cfg.Commit.Committer)
+	require.Equal(t, "chore({{ .Group }}): promote {{ .App }} to {{ .Env }}", cfg.Commit.Message)
+	require.Equal(t, "Refs {{ .Tag }}", cfg.PullRequest.Description)
+}
+
+func TestConfigCommitInvalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		expectedErr string
+	}{
+		{
+			name: "incomplete identity",
+			data: `
+    environments:
+      - name: dev
+    commit:
+      committer:
+        name: Promotion Bot
+  `,
+			expectedErr: "commit committer requires both name and email",
+		},
+		{
+			name: "invalid template",
+			data: `
+    environments:
+      - name: dev
+    pullRequest:
+      title: "{{ .Group"
+  `,
+			expectedErr: "invalid pull request title template",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadConfig(bytes.NewReader([]byte(c.data)))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expectedErr)
+		})
+	}
+}
+
+func TestConfigRemote(t *testing.T) {
+	data := `
+    environments:
+      - name: dev
+        auto: true
+    remote: upstream
+    defaultBranch: master
+  `
+	reader := bytes.NewReader([]byte(data))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+	require.Equal(t, "upstream", cfg.Remote)
+	require.Equal(t, "master", cfg.DefaultBranch)
+}
+
 func TestConfigStatusTimeout(t *testing.T) {
 	data := `
     environments:
@@ -182,7 +425,80 @@ func TestConfigStatusTimeout(t *testing.T) {
 	reader := bytes.NewReader([]byte(data))
 	cfg, err := LoadConfig(reader)
 	require.NoError(t, err)
-	require.Equal(t, 5*time.Minute, cfg.StatusTimeout)
+	require.Equal(t, 5*time.Minute, cfg.StatusTimeout.Duration)
+}
+
+func TestConfigStatusTimeoutValues(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "10", expected: 10 * time.Minute},
+		{value: "1.5", expected: 90 * time.Second},
+		{value: "10m", expected: 10 * time.Minute},
+		{value: `"90s"`, expected: 90 * time.Second},
+		{value: "1h30m", expected: 90 * time.Minute},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			data := fmt.Sprintf("status_timeout_minutes: %s\nenvironments:\n  - name: dev\n", c.value)
+			cfg, err := LoadConfig(bytes.NewReader([]byte(data)))
+			require.NoError(t, err)
+			require.Equal(t, c.expected, cfg.StatusTimeout.Duration)
+		})
+	}
+
+	for _, value := range []string{"ten", "-5", "[10]"} {
+		data := fmt.Sprintf("status_timeout_minutes: %s\nenvironments:\n  - name: dev\n", value)
+		_, err := LoadConfig(bytes.NewReader([]byte(data)))
+		require.Error(t, err, value)
+	}
+}
+
+func TestConfigStatusPollIntervalValues(t *testing.T) {
+	data := "status_poll_interval: 1m30s\nenvironments:\n  - name: dev\n"
+	cfg, err := LoadConfig(bytes.NewReader([]byte(data)))
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, cfg.StatusPollInterval.Duration)
+
+	for _, value := range []string{"5", "1.5", "-5s", "five"} {
+		data := fmt.Sprintf("status_poll_interval: %s\nenvironments:\n  - name: dev\n", value)
+		_, err := LoadConfig(bytes.NewReader([]byte(data)))
+		require.Error(t, err, value)
+		require.Contains(t, err.Error(), "invalid interval", value)
+	}
+}
+
+func TestConfigEnvironmentStatus(t *testing.T) {
+	data := `
+    status_timeout_minutes: 10
+    environments:
+      - name: dev
+        auto: true
+      - name: prod
+        status_timeout_minutes: 30
+        status_poll_interval: 30s
+  `
+	reader := bytes.NewReader([]byte(data))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+
+	timeout, err := cfg.GetStatusTimeout("dev")
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Minute, timeout)
+	interval, err := cfg.GetStatusPollInterval("dev")
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, interval)
+
+	timeout, err = cfg.GetStatusTimeout("prod")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, timeout)
+	interval, err = cfg.GetStatusPollInterval("prod")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, interval)
+
+	_, err = cfg.GetStatusTimeout("qa")
+	require.EqualError(t, err, "environment named qa does not exist")
 }
 
 func TestConfigFeature(t *testing.T) {
@@ -207,3 +523,243 @@ func TestConfigFeature(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, map[string]string{"app": "podinfo"}, featureLabelSelector)
 }
+
+const groupData = `
+prflow: per-env
+status_timeout_minutes: 10m
+environments:
+  - name: dev
+    auto: true
+  - name: qa
+    auto: true
+  - name: staging
+    auto: false
+  - name: prod
+    auto: false
+groups:
+  webshop:
+    applications:
+      cart: {}
+  platform:
+    status_timeout_minutes: 20
+    environments:
+      - name: dev
+        auto: true
+      - name: prod
+        auto: true
+    applications:
+      ingress: {}
+`
+
+func TestConfigForGroup(t *testing.T) {
+	reader := bytes.NewReader([]byte(groupData))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+
+	webshop := cfg.ForGroup("webshop")
+	require.Len(t, webshop.Environments, 4)
+	require.Equal(t, 10*time.Minute, webshop.StatusTimeout.Duration)
+	next, err := webshop.NextEnvironment("dev")
+	require.NoError(t, err)
+	require.Equal(t, "qa", next.Name)
+
+	platform := cfg.ForGroup("platform")
+	require.Len(t, platform.Environments, 2)
+	require.Equal(t, 20*time.Minute, platform.StatusTimeout.Duration)
+	next, err = platform.NextEnvironment("dev")
+	require.NoError(t, err)
+	require.Equal(t, "prod", next.Name)
+	auto, err := platform.IsEnvironmentAutomated("prod")
+	require.NoError(t, err)
+	require.True(t, auto)
+	_, err = platform.IsEnvironmentAutomated("qa")
+	require.EqualError(t, err, "environment named qa does not exist")
+
+	require.Equal(t, cfg.Environments, cfg.ForGroup("unknown").Environments)
+	require.Len(t, cfg.Environments, 4)
+}
+
+func TestConfigForGroupInvalid(t *testing.T) {
+	data := `
+    environments:
+      - name: dev
+        auto: true
+    groups:
+      platform:
+        environments:
+          - name: dev
+            auto: true
+          - name: prod
+            auto: true
+            after: [qa]
+  `
+	reader := bytes.NewReader([]byte(data))
+	_, err := LoadConfig(reader)
+	require.EqualError(t, err, "group platform: environment prod is after qa which is not declared before it")
+}
+
+const appPolicyData = `
+prflow: per-env
+environments:
+  - name: dev
+    auto: true
+  - name: qa
+    auto: true
+  - name: prod-eu
+    auto: true
+  - name: prod-us
+    auto: true
+    after: [qa]
+  - name: verify
+    auto: false
+    after: [prod-eu, prod-us]
+groups:
+  apps:
+    applications:
+      full: {}
+      internal:
+        stopAt: qa
+      skipdev:
+        environments: [qa, prod-eu, prod-us, verify]
+        auto:
+          prod-eu: false
+      eu:
+        environments: [dev, prod-eu, verify]
+        stopAt: prod-eu
+`
+
+func TestConfigForApp(t *testing.T) {
+	reader := bytes.NewReader([]byte(appPolicyData))
+	cfg, err := LoadConfig(reader)
+	require.NoError(t, err)
+	names := func(envs []Environment) []string {
+		result := []string{}
+		for _, e := range envs {
+			result = append(result, e.Name)
+		}
+		return result
+	}
+
+	full := cfg.ForApp("apps", "full")
+	require.Equal(t, []string{"dev", "qa", "prod-eu", "prod-us", "verify"}, names(full.Environments))
+	require.Equal(t, []string{"prod-eu", "prod-us"}, names(full.NextEnvironments("qa")))
+	require.Equal(t, cfg.Environments, cfg.ForApp("apps", "unknown").Environments)
+
+	internal := cfg.ForApp("apps", "internal")
+	require.Equal(t, []string{"dev", "qa"}, names(internal.Environments))
+	require.False(t, internal.HasNextEnvironment("qa"))
+
+	skipdev := cfg.ForApp("apps", "skipdev")
+	require.Equal(t, "qa", skipdev.Environments[0].Name)
+	require.Equal(t, []string{"prod-eu", "prod-us"}, names(skipdev.NextEnvironments("qa")))
+	auto, err := skipdev.IsEnvironmentAutomated("prod-eu")
+	require.NoError(t, err)
+	require.False(t, auto)
+	auto, err = skipdev.IsEnvironmentAutomated("prod-us")
+	require.NoError(t, err)
+	require.True(t, auto)
+
+	eu := cfg.ForApp("apps", "eu")
+	require.Equal(t, []string{"dev", "prod-eu"}, names(eu.Environments))
+	next, err := eu.NextEnvironment("dev")
+	require.NoError(t, err)
+	require.Equal(t, "prod-eu", next.Name)
+	prev, err := eu.PrevEnvironment("prod-eu")
+	require.NoError(t, err)
+	require.Equal(t, "dev", prev.Name)
+	require.False(t, eu.HasNextEnvironment("prod-eu"))
+
+	// The config itself is not changed
+	require.Len(t, cfg.Environments, 5)
+	require.Equal(t, []string{"qa"}, cfg.Environments[3].After)
+}
+
+func TestGetHelmRelease(t *testing.T) {
+	data := `environments:
+  - name: dev
+groups:
+  apps:
+    applications:
+      podinfo:
+        helmRelease:
+          name: podinfo
+      redis:
+        helmRelease:
+          valuesFile: values/redis.yaml
+          valuesPath: redis.image.tag
+      frontend: {}
+`
+	cfg, err := LoadConfig(bytes.NewReader([]byte(data)))
+	require.NoError(t, err)
+
+	podinfo := cfg.GetHelmRelease("apps", "podinfo")
+	require.Equal(t, "podinfo", podinfo.Name)
+	require.Equal(t, []string{"image", "tag"}, podinfo.GetValuesPath())
+	redis := cfg.GetHelmRelease("apps", "redis")
+	require.Equal(t, "values/redis.yaml", redis.ValuesFile)
+	require.Equal(t, []string{"redis", "image", "tag"}, redis.GetValuesPath())
+	require.Nil(t, cfg.GetHelmRelease("apps", "frontend"))
+	require.Nil(t, cfg.GetHelmRelease("other", "app"))
+}
+
+func TestConfigForAppInvalid(t *testing.T) {
+	cases := []struct {
+		app     string
+		message string
+	}{
+		{
+			app:     "{environments: [dev, staging]}",
+			message: "application apps/podinfo has unknown environment staging",
+		},
+		{
+			app:     "{stopAt: staging}",
+			message: "application apps/podinfo stops at unknown environment staging",
+		},
+		{
+			app:     "{auto: {staging: true}}",
+			message: "application apps/podinfo has auto for unknown environment staging",
+		},
+		{
+			app:     "{environments: [prod], stopAt: dev}",
+			message: "application apps/podinfo is not promoted to any environment",
+		},
+		{
+			app:     "{environments: [qa-a, qa-b, prod]}",
+			message: "application apps/podinfo has more than one first environment: qa-a, qa-b",
+		},
+		{
+			app:     "{helmRelease: {valuesPath: image.tag}}",
+			message: "helmRelease of apps/podinfo requires exactly one of name or valuesFile",
+		},
+		{
+			app:     "{helmRelease: {name: podinfo, valuesFile: values.yaml}}",
+			message: "helmRelease of apps/podinfo requires exactly one of name or valuesFile",
+		},
+		{
+			app:     "{helmRelease: {valuesFile: ../values.yaml}}",
+			message: "valuesFile ../values.yaml of apps/podinfo has to be inside the environment directory",
+		},
+		{
+			app:     "{helmRelease: {name: podinfo, valuesPath: image..tag}}",
+			message: "invalid valuesPath \"image..tag\" of apps/podinfo",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.app, func(t *testing.T) {
+			data := `prflow: per-env
+environments:
+  - name: dev
+  - name: qa-a
+  - name: qa-b
+    after: [dev]
+  - name: prod
+    after: [qa-a, qa-b]
+groups:
+  apps:
+    applications:
+      podinfo: ` + c.app + "\n"
+			_, err := LoadConfig(bytes.NewReader([]byte(data)))
+			require.EqualError(t, err, c.message)
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FreezeWindow is a period during which an environment is frozen. It is either a date range from
+// Start to End, or starts at every time matching the Cron schedule and lasts for Duration. Times are
+// in TimeZone, which defaults to UTC.
+type FreezeWindow struct {
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Cron     string   `yaml:"cron"`
+	Duration Duration `yaml:"duration"`
+	TimeZone string   `yaml:"timezone"`
+	Reason   string   `yaml:"reason"`
+}
+
+// Lock freezes an environment until it is unlocked, or until Until if it is set.
+type Lock struct {
+	Reason string     `yaml:"reason"`
+	Until  *time.Time `yaml:"until,omitempty"`
+}
+
+// Locks are the locked environments by name, as stored in the lock file.
+type Locks map[string]Lock
+
+// Freeze is why and until when an environment is frozen. Until is zero if the environment is frozen
+// until it is unlocked.
+type Freeze struct {
+	Until  time.Time
+	Reason string
+}
+
+func (f Freeze) String() string {
+	until := "unlocked"
+	if !f.Until.IsZero() {
+		until = f.Until.Format(time.RFC3339)
+	}
+	if f.Reason == "" {
+		return fmt.Sprintf("frozen until %s", until)
+	}
+	return fmt.Sprintf("frozen until %s: %s", until, f.Reason)
+}
+
+// LoadLocks reads the locks from a lock file, an empty file has no locks.
+func LoadLocks(file io.Reader) (Locks, error) {
+	locks := Locks{}
+	decoder := yaml.NewDecoder(file)
+	decoder.SetStrict(true)
+	err := decoder.Decode(&locks)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// maxFreezeChain limits how many adjacent freeze windows are followed to find when a freeze ends.
+const maxFreezeChain = 100
+
+// GetFreeze returns the freeze of the named environment at the given time, or nil if the environment
+// is not frozen. Adjacent and overlapping freeze windows are treated as a single freeze.
+func (c Config) GetFreeze(name string, locks Locks, now time.Time) (*Freeze, error) {
+	e, _, err := c.getEnvironment(name)
+	if err != nil {
+		return nil, err
+	}
+	if lock, ok := locks[name]; ok && (lock.Until == nil || now.Before(*lock.Until)) {
+		freeze := &Freeze{Reason: lock.Reason}
+		if lock.Until != nil {
+			freeze.Until = *lock.Until
+		}
+		return freeze, nil
+	}
+
+	var freeze *Freeze
+	at := now
+	for i := 0; i < maxFreezeChain; i++ {
+		next, err := activeFreeze(e.Freeze, at)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			break
+		}
+		if freeze == nil {
+			freeze = next
+		}
+		freeze.Until = next.Until
+		at = next.Until
+	}
+	return freeze, nil
+}
+
+// activeFreeze returns the active freeze window that ends last at the given time.
+func activeFreeze(windows []FreezeWindow, now time.Time) (*Freeze, error) {
+	var freeze *Freeze
+	for _, w := range windows {
+		until, active, err := w.activeUntil(now)
+		if err != nil {
+			return nil, err
+		}
+		if active && (freeze == nil || until.After(freeze.Until)) {
+			freeze = &Freeze{Until: until, Reason: w.Reason}
+		}
+	}
+	return freeze, nil
+}
+
+var freezeTimeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// activeUntil returns when the window ends if it is active at the given time.
+func (w FreezeWindow) activeUntil(now time.Time) (time.Time, bool, error) {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid freeze timezone %q: %w", w.TimeZone, err)
+	}
+	now = now.In(loc)
+	if w.Cron == "" {
+		start, err := parseFreezeTime(w.Start, loc)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		end, err := parseFreezeTime(w.End, loc)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return end, !now.Before(start) && now.Before(end), nil
+	}
+
+	schedule, err := parseCron(w.Cron)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// The window is active if it started less than its duration ago
+	earliest := now.Add(-w.Duration.Duration)
+	for t := now.Truncate(time.Minute); t.After(earliest); t = t.Add(-time.Minute) {
+		if schedule.matches(t) {
+			return t.Add(w.Duration.Duration), true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+func (w FreezeWindow) validate() error {
+	_, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid freeze timezone %q: %w", w.TimeZone, err)
+	}
+	if w.Cron != "" {
+		if w.Start != "" || w.End != "" {
+			return fmt.Errorf("freeze window cannot have both a cron schedule and start or end")
+		}
+		if w.Duration.Duration <= 0 {
+			return fmt.Errorf("freeze window with cron schedule %q requires a duration", w.Cron)
+		}
+		_, err := parseCron(w.Cron)
+		return err
+	}
+	if w.Start == "" || w.End == "" {
+		return fmt.Errorf("freeze window requires either a cron schedule or both start and end")
+	}
+	start, err := parseFreezeTime(w.Start, time.UTC)
+	if err != nil {
+		return err
+	}
+	end, err := parseFreezeTime(w.End, time.UTC)
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return fmt.Errorf("freeze window end %s has to be after start %s", w.End, w.Start)
+	}
+	return nil
+}
+
+func parseFreezeTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range freezeTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid freeze time %q, expected a date like 2006-01-02 or 2006-01-02T15:04", value)
+}
+
+// cronSchedule is a parsed cron expression with a bit set for every allowed value of each field.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// parseCron parses a standard cron expression with the fields minute, hour, day of month, month
+// and day of week. Fields can be *, values, ranges and steps, separated by commas.
+func parseCron(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("invalid cron schedule %q, expected 5 fields", expr)
+	}
+	bounds := []struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	bits := make([]uint64, 5)
+	for i, field := range fields {
+		b, err := parseCronField(field, bounds[i].min, bounds[i].max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid cron schedule %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+	// Both 0 and 7 are Sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		start, end, step, err := parseCronRange(part, min, max)
+		if err != nil {
+			return 0, err
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseCronRange parses a single value, range or step of a cron field like 5, 1-5, */15 or 5/15.
+func parseCronRange(part string, min, max int) (int, int, int, error) {
+	// TODO: Replace with strings.Cut in Go 1.18
+	comps := strings.SplitN(part, "/", 2)
+	rangePart, hasStep := comps[0], len(comps) == 2
+	step := 1
+	if hasStep {
+		var err error
+		step, err = strconv.Atoi(comps[1])
+		if err != nil || step < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid step in %q", part)
+		}
+	}
+	if rangePart == "*" {
+		return min, max, step, nil
+	}
+	comps = strings.SplitN(rangePart, "-", 2)
+	hasEnd := len(comps) == 2
+	start, err := strconv.Atoi(comps[0])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid value in %q", part)
+	}
+	end := start
+	switch {
+	case hasEnd:
+		end, err = strconv.Atoi(comps[1])
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid value in %q", part)
+		}
+	case hasStep:
+		end = max
+	}
+	if start < min || end > max || start > end {
+		return 0, 0, 0, fmt.Errorf("value out of range %d-%d in %q", min, max, part)
+	}
+	return start, end, step, nil
+}
+
+// matches returns true if the schedule matches the minute of the time, in the location of the time.
+// Like in cron the day matches either the day of month or day of week when both are restricted.
+func (s cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
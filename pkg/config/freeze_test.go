@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const freezeData = `
+environments:
+  - name: dev
+    auto: true
+  - name: prod
+    auto: true
+    freeze:
+      - start: 2026-12-20
+        end: 2027-01-06
+        timezone: Europe/Stockholm
+        reason: christmas
+      - cron: "0 17 * * 1-5"
+        duration: 15h
+        timezone: Europe/Stockholm
+      - cron: "0 17 * * 5"
+        duration: 63h
+        timezone: Europe/Stockholm
+`
+
+func TestConfigGetFreeze(t *testing.T) {
+	cfg, err := LoadConfig(bytes.NewReader([]byte(freezeData)))
+	require.NoError(t, err)
+	loc, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		now    time.Time
+		until  time.Time
+		reason string
+	}{
+		{
+			name: "business hours",
+			now:  time.Date(2026, 10, 14, 10, 0, 0, 0, loc),
+		},
+		{
+			name:  "weekday evening",
+			now:   time.Date(2026, 10, 14, 17, 0, 0, 0, loc),
+			until: time.Date(2026, 10, 15, 8, 0, 0, 0, loc),
+		},
+		{
+			name:  "weekday morning in another time zone",
+			now:   time.Date(2026, 10, 15, 5, 59, 0, 0, time.UTC),
+			until: time.Date(2026, 10, 15, 8, 0, 0, 0, loc),
+		},
+		{
+			name: "weekday morning after freeze",
+			now:  time.Date(2026, 10, 15, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "weekend",
+			now:   time.Date(2026, 10, 17, 12, 0, 0, 0, loc),
+			until: time.Date(2026, 10, 19, 8, 0, 0, 0, loc),
+		},
+		{
+			name:   "date range joined with weekday evening",
+			now:    time.Date(2026, 12, 24, 12, 0, 0, 0, loc),
+			until:  time.Date(2027, 1, 6, 8, 0, 0, 0, loc),
+			reason: "christmas",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			freeze, err := cfg.GetFreeze("prod", Locks{}, c.now)
+			require.NoError(t, err)
+			if c.until.IsZero() {
+				require.Nil(t, freeze)
+				return
+			}
+			require.NotNil(t, freeze)
+			require.True(t, c.until.Equal(freeze.Until), "expected %s got %s", c.until, freeze.Until)
+			require.Equal(t, c.reason, freeze.Reason)
+		})
+	}
+
+	freeze, err := cfg.GetFreeze("dev", Locks{}, time.Date(2026, 10, 17, 12, 0, 0, 0, loc))
+	require.NoError(t, err)
+	require.Nil(t, freeze)
+}
+
+func TestConfigGetFreezeLocks(t *testing.T) {
+	cfg, err := LoadConfig(bytes.NewReader([]byte(freezeData)))
+	require.NoError(t, err)
+	locks, err := LoadLocks(bytes.NewReader([]byte(`
+dev:
+  reason: incident
+  until: 2026-10-14T12:00:00Z
+`)))
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+
+	freeze, err := cfg.GetFreeze("dev", locks, now)
+	require.NoError(t, err)
+	require.Equal(t, "frozen until 2026-10-14T12:00:00Z: incident", freeze.String())
+	freeze, err = cfg.GetFreeze("dev", locks, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Nil(t, freeze)
+
+	freeze, err = cfg.GetFreeze("dev", Locks{"dev": {}}, now)
+	require.NoError(t, err)
+	require.Equal(t, "frozen until unlocked", freeze.String())
+
+	locks, err = LoadLocks(bytes.NewReader([]byte{}))
+	require.NoError(t, err)
+	require.Empty(t, locks)
+}
+
+func TestConfigFreezeInvalid(t *testing.T) {
+	cases := []struct {
+		freeze  string
+		message string
+	}{
+		{
+			freeze:  `{start: 2026-12-20}`,
+			message: "environment dev: freeze window requires either a cron schedule or both start and end",
+		},
+		{
+			freeze:  `{start: 2026-12-20, end: 2026-12-01}`,
+			message: "environment dev: freeze window end 2026-12-01 has to be after start 2026-12-20",
+		},
+		{
+			freeze:  `{start: 20-12-2026, end: 2027-01-01}`,
+			message: `environment dev: invalid freeze time "20-12-2026", expected a date like 2006-01-02 or 2006-01-02T15:04`,
+		},
+		{
+			freeze:  `{cron: "0 17 * * 1-5"}`,
+			message: `environment dev: freeze window with cron schedule "0 17 * * 1-5" requires a duration`,
+		},
+		{
+			freeze:  `{cron: "0 25 * * *", duration: 1h}`,
+			message: `environment dev: invalid cron schedule "0 25 * * *": value out of range 0-23 in "25"`,
+		},
+		{
+			freeze:  `{cron: "0 17 * *", duration: 1h}`,
+			message: `environment dev: invalid cron schedule "0 17 * *", expected 5 fields`,
+		},
+		{
+			freeze:  `{cron: "0 17 * * *", duration: 1h, timezone: Mars/Olympus}`,
+			message: `environment dev: invalid freeze timezone "Mars/Olympus"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.freeze, func(t *testing.T) {
+			data := "environments:\n  - name: dev\n    freeze:\n      - " + c.freeze + "\n"
+			_, err := LoadConfig(bytes.NewReader([]byte(data)))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.message)
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	schedule, err := parseCron("*/15 8-17/3 1,15 * 0")
+	require.NoError(t, err)
+	require.True(t, schedule.matches(time.Date(2026, 10, 1, 8, 45, 0, 0, time.UTC)))
+	require.True(t, schedule.matches(time.Date(2026, 10, 18, 14, 0, 0, 0, time.UTC)))
+	require.False(t, schedule.matches(time.Date(2026, 10, 2, 14, 0, 0, 0, time.UTC)))
+	require.False(t, schedule.matches(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)))
+	require.False(t, schedule.matches(time.Date(2026, 10, 1, 8, 10, 0, 0, time.UTC)))
+
+	schedule, err = parseCron("30 5/6 * * 7")
+	require.NoError(t, err)
+	require.True(t, schedule.matches(time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC)))
+	require.False(t, schedule.matches(time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)))
+}
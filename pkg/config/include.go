@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// includedConfig is the part of the config that can be set in included files.
+type includedConfig struct {
+	Groups map[string]Group `yaml:"groups"`
+}
+
+// configFile is a file of the config, with the name relative to the directory of the main config file.
+type configFile struct {
+	name string
+	data []byte
+}
+
+// loadedConfig is a config merged from the main config file and the files it includes. The files
+// start with the main config file, and errs are the problems found when merging them.
+type loadedConfig struct {
+	cfg   Config
+	files []configFile
+	errs  []error
+}
+
+// LoadConfigFile loads the config file at path and merges the groups of the files matching its
+// include globs into it. The globs are relative to the directory of the config file.
+func LoadConfigFile(fs afero.Fs, path string) (Config, error) {
+	loaded, err := loadConfigFiles(fs, path)
+	if err != nil {
+		return Config{}, err
+	}
+	errs := loaded.errs
+	errs = append(errs, validateConfig(loaded.cfg)...)
+	if len(errs) > 0 {
+		return Config{}, errs[0]
+	}
+	return loaded.cfg, nil
+}
+
+// loadConfigFiles reads and decodes the config file at path and merges the included files into it.
+// An error is only returned if the config file itself can not be read or decoded, in which case
+// the files are still returned if it could be read.
+func loadConfigFiles(fs afero.Fs, path string) (loadedConfig, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return loadedConfig{}, err
+	}
+	loaded := loadedConfig{
+		files: []configFile{{name: filepath.Base(path), data: b}},
+	}
+	cfg, err := decodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return loaded, err
+	}
+	loaded.cfg = cfg
+	names, errs := includedFileNames(fs, path, cfg.Include)
+	loaded.errs = errs
+	if len(names) == 0 {
+		return loaded, nil
+	}
+
+	merger := newGroupMerger(cfg.Groups, filepath.Base(path))
+	for _, name := range names {
+		b, err := afero.ReadFile(fs, filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			loaded.errs = append(loaded.errs, &ValidationError{File: name, Err: err})
+			continue
+		}
+		loaded.files = append(loaded.files, configFile{name: name, data: b})
+		included := includedConfig{}
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.SetStrict(true)
+		err = decoder.Decode(&included)
+		if err != nil {
+			loaded.errs = append(loaded.errs, decodeErrors(name, err)...)
+			continue
+		}
+		loaded.errs = append(loaded.errs, merger.merge(included.Groups, name)...)
+	}
+	loaded.cfg.Groups = merger.groups
+	return loaded, nil
+}
+
+// includedFileNames returns the files matching the include globs relative to the directory of the
+// config file. Files are ordered by the glob that first matches them and then by name, and the config
+// file itself is never included.
+func includedFileNames(fs afero.Fs, path string, globs []string) ([]string, []error) {
+	dir := filepath.Dir(path)
+	seen := map[string]bool{filepath.Base(path): true}
+	names := []string{}
+	errs := []error{}
+	for i, glob := range globs {
+		matches, err := afero.Glob(fs, filepath.Join(dir, glob))
+		if err != nil {
+			errs = append(errs, newValidationError([]string{"include", fmt.Sprint(i)}, "invalid include glob %q: %w", glob, err))
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			name, err := filepath.Rel(dir, match)
+			if err != nil {
+				errs = append(errs, newValidationError([]string{"include", fmt.Sprint(i)}, "invalid include %q: %w", match, err))
+				continue
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, errs
+}
+
+// groupMerger merges groups from several files. A group can be split across files, but its
+// environments, its status timeout and each of its applications can only be set in one file.
+type groupMerger struct {
+	groups  map[string]Group
+	sources map[string]string
+}
+
+func newGroupMerger(groups map[string]Group, file string) *groupMerger {
+	m := &groupMerger{
+		groups:  map[string]Group{},
+		sources: map[string]string{},
+	}
+	m.merge(groups, file)
+	return m
+}
+
+// merge adds the groups from the file, returning errors for everything that is already set by
+// another file.
+func (m *groupMerger) merge(groups map[string]Group, file string) []error {
+	errs := []error{}
+	for _, name := range sortedGroupNames(groups) {
+		group := groups[name]
+		merged := m.groups[name]
+		if merged.Applications == nil {
+			merged.Applications = map[string]App{}
+		}
+		if len(group.Environments) > 0 {
+			if err := m.claim(file, []string{"groups", name, "environments"}, "environments of group %s", name); err != nil {
+				errs = append(errs, err)
+			} else {
+				merged.Environments = group.Environments
+			}
+		}
+		if group.StatusTimeout.Duration != 0 {
+			if err := m.claim(file, []string{"groups", name, "status_timeout_minutes"}, "status timeout of group %s", name); err != nil {
+				errs = append(errs, err)
+			} else {
+				merged.StatusTimeout = group.StatusTimeout
+			}
+		}
+		for _, app := range sortedAppNames(group.Applications) {
+			if err := m.claim(file, []string{"groups", name, "applications", app}, "application %s/%s", name, app); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			merged.Applications[app] = group.Applications[app]
+		}
+		m.groups[name] = merged
+	}
+	return errs
+}
+
+// claim records that the file sets the value at path, or returns an error if another file already does.
+func (m *groupMerger) claim(file string, path []string, format string, a ...interface{}) error {
+	key := fmt.Sprint(path)
+	if source, ok := m.sources[key]; ok {
+		return &ValidationError{File: file, Path: path, Err: fmt.Errorf("%s is already defined in %s", fmt.Sprintf(format, a...), source)}
+	}
+	m.sources[key] = file
+	return nil
+}
+
+func sortedGroupNames(groups map[string]Group) []string {
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedAppNames(apps map[string]App) []string {
+	names := []string{}
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func memFs(t *testing.T, files map[string]string) afero.Fs {
+	t.Helper()
+	fs := afero.NewMemMapFs()
+	for name, data := range files {
+		require.NoError(t, afero.WriteFile(fs, name, []byte(data), 0600))
+	}
+	return fs
+}
+
+const includeData = `environments:
+  - name: dev
+  - name: qa
+  - name: prod
+include:
+  - teams/*.yaml
+groups:
+  apps:
+    applications:
+      podinfo: {}
+`
+
+func TestLoadConfigFileInclude(t *testing.T) {
+	fs := memFs(t, map[string]string{
+		"repo/gitops-promotion.yaml": includeData,
+		"repo/teams/a.yaml": `groups:
+  apps:
+    applications:
+      frontend:
+        stopAt: qa
+`,
+		"repo/teams/b.yaml": `groups:
+  backend:
+    environments:
+      - name: dev
+      - name: prod
+    applications:
+      api: {}
+`,
+		"repo/teams/notes.txt": "not included",
+	})
+	cfg, err := LoadConfigFile(fs, "repo/gitops-promotion.yaml")
+	require.NoError(t, err)
+	require.Equal(t, []string{"apps", "backend"}, cfg.GroupNames())
+	require.Len(t, cfg.Groups["apps"].Applications, 2)
+	require.Equal(t, "qa", cfg.Groups["apps"].Applications["frontend"].StopAt)
+	require.Len(t, cfg.Groups["backend"].Environments, 2)
+
+	appCfg := cfg.ForApp("backend", "api")
+	require.Len(t, appCfg.Environments, 2)
+	require.Equal(t, "prod", appCfg.Environments[1].Name)
+}
+
+func TestLoadConfigFileIncludeConflict(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   map[string]string
+		message string
+	}{
+		{
+			name: "application in main file",
+			files: map[string]string{
+				"teams/a.yaml": "groups:\n  apps:\n    applications:\n      podinfo: {}\n",
+			},
+			message: "teams/a.yaml: application apps/podinfo is already defined in gitops-promotion.yaml",
+		},
+		{
+			name: "group environments",
+			files: map[string]string{
+				"teams/a.yaml": "groups:\n  backend:\n    environments: [{name: dev}]\n",
+				"teams/b.yaml": "groups:\n  backend:\n    environments: [{name: prod}]\n",
+			},
+			message: "teams/b.yaml: environments of group backend is already defined in teams/a.yaml",
+		},
+		{
+			name: "unknown key",
+			files: map[string]string{
+				"teams/a.yaml": "prflow: per-env\n",
+			},
+			message: "teams/a.yaml:1: field prflow not found in type config.includedConfig",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.files["gitops-promotion.yaml"] = includeData
+			_, err := LoadConfigFile(memFs(t, c.files), "gitops-promotion.yaml")
+			require.Error(t, err)
+			require.Equal(t, c.message, err.Error())
+		})
+	}
+}
+
+func TestLoadConfigReaderInclude(t *testing.T) {
+	_, err := LoadConfig(bytes.NewReader([]byte(includeData)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "include is only supported when loading the config from a file")
+}
+
+func TestValidateConfigInclude(t *testing.T) {
+	fs := memFs(t, map[string]string{
+		"gitops-promotion.yaml": includeData,
+		"teams/a.yaml": `groups:
+  apps:
+    applications:
+      frontend:
+        stopAt: staging
+      podinfo: {}
+`,
+	})
+	problems := ValidateConfig(fs, "gitops-promotion.yaml", func(cfg Config) []error {
+		return []error{
+			&ValidationError{Path: []string{"groups", "apps", "applications", "frontend"}, Err: errors.New("missing")},
+		}
+	})
+	lines := []string{}
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	require.Equal(t, []string{
+		"teams/a.yaml:6: application apps/podinfo is already defined in gitops-promotion.yaml",
+		"teams/a.yaml:5: application apps/frontend stops at unknown environment staging",
+		"teams/a.yaml:4: missing",
+	}, lines)
+}
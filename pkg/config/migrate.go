@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// APIVersion is the version of the config format that this version of gitops-promotion reads.
+const APIVersion = "gitops-promotion.xenit.io/v1"
+
+// migration rewrites a config file from the version before it to version. Migrations without a
+// migrate function do not change the format.
+type migration struct {
+	version string
+	migrate func(*kyaml.RNode) error
+}
+
+// migrations are applied in order to upgrade a config file, starting from configs without an
+// apiVersion. They edit the YAML nodes of the file so that comments are kept.
+var migrations = []migration{
+	{
+		// The first versioned format is the same as the unversioned one, only apiVersion is added
+		version: "gitops-promotion.xenit.io/v1",
+	},
+}
+
+// configVersion returns the apiVersion of the config file data, which is empty for unversioned
+// configs, and an error if this version of gitops-promotion can not read it.
+func configVersion(b []byte) (string, error) {
+	versioned := struct {
+		APIVersion string `yaml:"apiVersion"`
+	}{}
+	err := yaml.Unmarshal(b, &versioned)
+	if err != nil {
+		return "", err
+	}
+	if versioned.APIVersion != "" && migrationIndex(versioned.APIVersion) < 0 {
+		return "", newValidationError([]string{"apiVersion"}, "unsupported apiVersion %s, the latest supported version is %s",
+			versioned.APIVersion, latestVersion())
+	}
+	return versioned.APIVersion, nil
+}
+
+// migrationIndex returns the index of the migration to the version, or -1 if there is none.
+func migrationIndex(version string) int {
+	for i, m := range migrations {
+		if m.version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// MigrateConfig rewrites the config file data to the latest apiVersion, keeping its comments. The
+// data is returned as is if it already has the latest version.
+func MigrateConfig(b []byte) ([]byte, error) {
+	version, err := configVersion(b)
+	if err != nil {
+		return nil, err
+	}
+	if version == latestVersion() {
+		return b, nil
+	}
+	return migrateConfig(b, version)
+}
+
+// migrateConfig applies the migrations after version to the config file data and sets its
+// apiVersion to the latest version.
+func migrateConfig(b []byte, version string) ([]byte, error) {
+	node, err := kyaml.Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	if node.YNode().Kind != kyaml.MappingNode {
+		return nil, fmt.Errorf("config has to be a map")
+	}
+	for _, m := range migrations[migrationIndex(version)+1:] {
+		if m.migrate == nil {
+			continue
+		}
+		err := m.migrate(node)
+		if err != nil {
+			return nil, fmt.Errorf("could not migrate config to %s: %w", m.version, err)
+		}
+	}
+	setAPIVersion(node.YNode(), latestVersion())
+
+	// Keep the indentation of sequences in the file
+	seqIndent := kyaml.SequenceIndentStyle(kyaml.DeriveSeqIndentStyle(string(b)))
+	return kyaml.MarshalWithOptions(node.Document(), &kyaml.EncoderOptions{SeqIndent: seqIndent})
+}
+
+// needsMigration returns true if any migration after version changes the format of the config.
+func needsMigration(version string) bool {
+	for _, m := range migrations[migrationIndex(version)+1:] {
+		if m.migrate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// latestVersion returns the version of the last migration, which is APIVersion.
+func latestVersion() string {
+	return migrations[len(migrations)-1].version
+}
+
+// setAPIVersion sets apiVersion to the version, adding it as the first key of the map if it is
+// missing. Comments above the first key stay at the top of the file.
+func setAPIVersion(node *kyaml.Node, version string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "apiVersion" {
+			node.Content[i+1].Value = version
+			return
+		}
+	}
+	key := kyaml.NewScalarRNode("apiVersion").YNode()
+	if len(node.Content) > 0 {
+		key.HeadComment = node.Content[0].HeadComment
+		node.Content[0].HeadComment = ""
+	}
+	value := kyaml.NewScalarRNode(version).YNode()
+	node.Content = append([]*kyaml.Node{key, value}, node.Content...)
+}
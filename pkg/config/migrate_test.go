@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestMigrationsEndAtAPIVersion(t *testing.T) {
+	require.Equal(t, APIVersion, migrations[len(migrations)-1].version)
+}
+
+func TestLoadConfigAPIVersion(t *testing.T) {
+	cfg, err := LoadConfig(bytes.NewReader([]byte(simpleData)))
+	require.NoError(t, err)
+	require.Equal(t, APIVersion, cfg.APIVersion)
+
+	cfg, err = LoadConfig(bytes.NewReader([]byte("apiVersion: gitops-promotion.xenit.io/v1\n" + simpleData)))
+	require.NoError(t, err)
+	require.Equal(t, APIVersion, cfg.APIVersion)
+
+	_, err = LoadConfig(bytes.NewReader([]byte("apiVersion: gitops-promotion.xenit.io/v2\nnewField: true\n" + simpleData)))
+	require.EqualError(t, err, "unsupported apiVersion gitops-promotion.xenit.io/v2, the latest supported version is gitops-promotion.xenit.io/v1")
+}
+
+func TestMigrateConfig(t *testing.T) {
+	data := `# yaml-language-server: $schema=gitops-promotion.schema.json
+
+# Promote apps through all environments
+prflow: per-env
+environments:
+  - name: dev
+    auto: true # always deploy to dev
+  - name: prod
+    auto: false
+`
+	b, err := MigrateConfig([]byte(data))
+	require.NoError(t, err)
+	require.Equal(t, `# yaml-language-server: $schema=gitops-promotion.schema.json
+
+# Promote apps through all environments
+apiVersion: gitops-promotion.xenit.io/v1
+prflow: per-env
+environments:
+  - name: dev
+    auto: true # always deploy to dev
+  - name: prod
+    auto: false
+`, string(b))
+
+	cfg, err := LoadConfig(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, PRFlowTypePerEnv, cfg.PRFlow)
+
+	migrated, err := MigrateConfig(b)
+	require.NoError(t, err)
+	require.Equal(t, b, migrated)
+}
+
+func TestLoadConfigMigrates(t *testing.T) {
+	original := migrations
+	defer func() { migrations = original }()
+	// A format where prflow was called flow
+	migrations = append(original, migration{
+		version: "gitops-promotion.xenit.io/v2",
+		migrate: func(node *kyaml.RNode) error {
+			field := node.Field("flow")
+			if field == nil {
+				return nil
+			}
+			field.Key.YNode().Value = "prflow"
+			return nil
+		},
+	})
+
+	data := "apiVersion: gitops-promotion.xenit.io/v1\nflow: per-env\nenvironments:\n  - name: dev\n"
+	cfg, err := LoadConfig(bytes.NewReader([]byte(data)))
+	require.NoError(t, err)
+	require.Equal(t, PRFlowTypePerEnv, cfg.PRFlow)
+	require.Equal(t, "gitops-promotion.xenit.io/v2", cfg.APIVersion)
+
+	cfg, err = LoadConfig(bytes.NewReader([]byte("flow: per-env\nenvironments:\n  - name: dev\n")))
+	require.NoError(t, err)
+	require.Equal(t, PRFlowTypePerEnv, cfg.PRFlow)
+
+	_, err = LoadConfig(bytes.NewReader([]byte("apiVersion: gitops-promotion.xenit.io/v2\nflow: per-env\nenvironments:\n  - name: dev\n")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field flow not found")
+}
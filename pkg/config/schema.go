@@ -0,0 +1,116 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// schemaEnums are the allowed values of string types that only accept some values.
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(PRFlowType("")):    {string(PRFlowTypePerApp), string(PRFlowTypePerEnv)},
+	reflect.TypeOf(SigningFormat("")): {string(SigningFormatGPG), string(SigningFormatSSH)},
+}
+
+// schemaRequired are the properties of struct types that have to be set.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(Config{}):      {"environments"},
+	reflect.TypeOf(Environment{}): {"name"},
+}
+
+// schemaOverrides are schemas for types that are decoded from other types than their Go type.
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(Duration{}): {
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "number", "minimum": 0},
+			map[string]interface{}{"type": "string", "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h)?)+$`},
+		},
+	},
+	reflect.TypeOf(Interval{}): {
+		"type":    "string",
+		"pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+	},
+}
+
+// Schema returns a JSON Schema for the config file, generated from the config types.
+func Schema() ([]byte, error) {
+	schema, err := typeSchema(reflect.TypeOf(Config{}))
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "gitops-promotion.yaml"
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) (map[string]interface{}, error) {
+	if schema, ok := schemaOverrides[t]; ok {
+		return schema, nil
+	}
+	//nolint:exhaustive // all other kinds are unsupported
+	switch t.Kind() {
+	case reflect.String:
+		schema := map[string]interface{}{"type": "string"}
+		if enum, ok := schemaEnums[t]; ok {
+			schema["enum"] = enum
+		}
+		return schema, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Slice:
+		items, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// structSchema returns the schema of a struct, with the properties named after the YAML tags of
+// its fields. Unknown properties are not allowed as the config is decoded strictly.
+func structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			return nil, fmt.Errorf("field %s of %s has no YAML name", field.Name, t)
+		}
+		schema, err := typeSchema(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", field.Name, t, err)
+		}
+		properties[name] = schema
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t]; ok {
+		schema["required"] = required
+	}
+	return schema, nil
+}
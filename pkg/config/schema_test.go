@@ -0,0 +1,97 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const schemaPath = "../../gitops-promotion.schema.json"
+
+func TestSchemaInSync(t *testing.T) {
+	b, err := Schema()
+	require.NoError(t, err)
+	expected, err := os.ReadFile(schemaPath)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(b), "schema is out of date, run: make schema")
+}
+
+// schemaCheck returns an error if the value has properties that are not in the schema or values
+// that are not in an enum of the schema.
+func schemaCheck(schema map[string]interface{}, value interface{}, path string) error {
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, v := range enum {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+	}
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for key, item := range v {
+			itemSchema, ok := properties[fmt.Sprint(key)].(map[string]interface{})
+			if !ok {
+				itemSchema = additional
+			}
+			if itemSchema == nil {
+				return fmt.Errorf("%s: unknown property %v", path, key)
+			}
+			err := schemaCheck(itemSchema, item, fmt.Sprintf("%s.%v", path, key))
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range v {
+			err := schemaCheck(items, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	b, err := Schema()
+	require.NoError(t, err)
+	schema := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(b, &schema))
+
+	fixture, err := os.ReadFile("../../tests/testdata/repository/gitops-promotion.yaml")
+	require.NoError(t, err)
+	valid := []string{simpleData, graphData, groupData, appPolicyData, freezeData, string(fixture)}
+	for i, data := range valid {
+		t.Run(fmt.Sprintf("valid %d", i), func(t *testing.T) {
+			_, err := LoadConfig(bytes.NewReader([]byte(data)))
+			require.NoError(t, err)
+			var value interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(data), &value))
+			require.NoError(t, schemaCheck(schema, value, "$"))
+		})
+	}
+
+	invalid := []string{
+		"environments: [{name: dev}]\ngroups: {apps: {applications: {podinfo: {featureLabelSelecter: {app: podinfo}}}}}\n",
+		"environments: [{name: dev}]\nprflow: per-group\n",
+		"environments: [{name: dev, automated: true}]\n",
+	}
+	for i, data := range invalid {
+		t.Run(fmt.Sprintf("invalid %d", i), func(t *testing.T) {
+			_, err := LoadConfig(bytes.NewReader([]byte(data)))
+			require.Error(t, err)
+			var value interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(data), &value))
+			require.Error(t, schemaCheck(schema, value, "$"))
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// ValidationError is a problem with the value at Path in the config. Path contains map keys and
+// sequence indexes, e.g. groups, apps, environments, 0. File is set for problems in a specific file
+// of the config and Line if the line is already known.
+type ValidationError struct {
+	File string
+	Line int
+	Path []string
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.File != "" && e.Line != 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	default:
+		return e.Err.Error()
+	}
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func newValidationError(path []string, format string, a ...interface{}) error {
+	return &ValidationError{Path: path, Err: fmt.Errorf(format, a...)}
+}
+
+// Problem is a problem found in a config file. Line is zero when the line is not known.
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ValidateConfig returns all problems found in the config file at path and the files it includes.
+// The checks are run with the config as well if it can be decoded, they can return ValidationErrors
+// to point to the relevant part of the config.
+func ValidateConfig(fs afero.Fs, path string, checks ...func(Config) []error) []Problem {
+	name := filepath.Base(path)
+	loaded, err := loadConfigFiles(fs, path)
+	if err != nil {
+		return errorProblems(name, loaded.files, decodeErrors(name, err))
+	}
+	errs := loaded.errs
+	errs = append(errs, validateConfig(loaded.cfg)...)
+	for _, check := range checks {
+		errs = append(errs, check(loaded.cfg)...)
+	}
+	return errorProblems(name, loaded.files, errs)
+}
+
+// errorProblems converts errors into problems, looking up the line of ValidationErrors in the
+// files. Errors without a file are found in the file where most of their path exists.
+func errorProblems(name string, files []configFile, errs []error) []Problem {
+	nodes := map[string]*kyaml.Node{}
+	for _, file := range files {
+		node, err := kyaml.Parse(string(file.data))
+		if err == nil {
+			nodes[file.name] = node.YNode()
+		}
+	}
+	problems := []Problem{}
+	for _, err := range errs {
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			problems = append(problems, Problem{File: name, Message: err.Error()})
+			continue
+		}
+		problems = append(problems, validationErr.problem(name, files, nodes))
+	}
+	return problems
+}
+
+// problem returns the problem for the error, with the line looked up in the nodes of the files
+// unless it is already known.
+func (e *ValidationError) problem(name string, files []configFile, nodes map[string]*kyaml.Node) Problem {
+	problem := Problem{File: name, Line: e.Line, Message: e.Err.Error()}
+	if e.File != "" {
+		problem.File = e.File
+	}
+	if problem.Line != 0 {
+		return problem
+	}
+	bestDepth := -1
+	for _, file := range files {
+		node, ok := nodes[file.name]
+		if !ok || (e.File != "" && e.File != file.name) {
+			continue
+		}
+		line, depth := nodeLookup(node, e.Path)
+		if depth > bestDepth {
+			problem.File, problem.Line, bestDepth = file.name, line, depth
+		}
+	}
+	return problem
+}
+
+var yamlLineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// decodeErrors converts a decoding error of a file into ValidationErrors, using the line in the
+// error messages from the YAML decoder.
+func decodeErrors(name string, err error) []error {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return []error{&ValidationError{File: name, Path: validationErr.Path, Err: validationErr.Err}}
+	}
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	errs := []error{}
+	for _, message := range messages {
+		match := yamlLineRegexp.FindStringSubmatch(message)
+		if match == nil {
+			errs = append(errs, &ValidationError{File: name, Err: errors.New(message)})
+			continue
+		}
+		//nolint:errcheck // the regexp only matches digits
+		line, _ := strconv.Atoi(match[1])
+		errs = append(errs, &ValidationError{File: name, Line: line, Err: errors.New(match[2])})
+	}
+	return errs
+}
+
+// nodeLookup returns the line of the value at path in the node, or of its closest parent if the
+// path does not exist, and how many elements of the path exist. Map values use the line of their key.
+func nodeLookup(node *kyaml.Node, path []string) (int, int) {
+	if node.Kind == kyaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for depth, elem := range path {
+		var next *kyaml.Node
+		switch node.Kind {
+		case kyaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == elem {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+				}
+			}
+		case kyaml.SequenceNode:
+			i, err := strconv.Atoi(elem)
+			if err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			return line, depth
+		}
+		node = next
+	}
+	return line, len(path)
+}
+
+// validateConfig returns all problems with the values in the config.
+func validateConfig(cfg Config) []error {
+	if len(cfg.Environments) == 0 {
+		return []error{newValidationError([]string{"environments"}, "environments list cannot be empty")}
+	}
+	errs := []error{}
+	switch cfg.PRFlow {
+	case PRFlowTypePerApp, PRFlowTypePerEnv:
+		break
+	default:
+		errs = append(errs, newValidationError([]string{"prflow"}, "invalid prflow value: %s", cfg.PRFlow))
+	}
+	switch cfg.Signing.Format {
+	case SigningFormatGPG, SigningFormatSSH:
+		break
+	default:
+		errs = append(errs, newValidationError([]string{"signing", "format"}, "invalid signing format value: %s", cfg.Signing.Format))
+	}
+	errs = append(errs, validateEnvironments(cfg, []string{"environments"})...)
+	errs = append(errs, validateGroups(cfg)...)
+	errs = append(errs, validateTemplates(cfg)...)
+	identities := []struct {
+		name     string
+		identity Identity
+	}{
+		{"author", cfg.Commit.Author},
+		{"committer", cfg.Commit.Committer},
+	}
+	for _, i := range identities {
+		if (i.identity.Name == "") != (i.identity.Email == "") {
+			errs = append(errs, newValidationError([]string{"commit", i.name}, "commit %s requires both name and email", i.name))
+		}
+	}
+	return errs
+}
+
+// validateEnvironments checks that the environments form a graph with the first environment as
+// its only root. Environments can only be after environments declared before them, which means
+// that the graph can not have any cycles.
+func validateEnvironments(cfg Config, path []string) []error {
+	errs := []error{}
+	if len(cfg.Environments[0].After) > 0 {
+		errs = append(errs, newValidationError(appendPath(path, "0", "after"),
+			"first environment %s cannot be after other environments", cfg.Environments[0].Name))
+	}
+	declared := map[string]bool{}
+	unique := true
+	for i, e := range cfg.Environments {
+		if declared[e.Name] {
+			unique = false
+			errs = append(errs, newValidationError(appendPath(path, strconv.Itoa(i), "name"), "environment %s is declared more than once", e.Name))
+		}
+		for _, after := range e.After {
+			if !declared[after] {
+				errs = append(errs, newValidationError(appendPath(path, strconv.Itoa(i), "after"),
+					"environment %s is after %s which is not declared before it", e.Name, after))
+			}
+		}
+		declared[e.Name] = true
+		for j, w := range e.Freeze {
+			err := w.validate()
+			if err != nil {
+				errs = append(errs, newValidationError(appendPath(path, strconv.Itoa(i), "freeze", strconv.Itoa(j)), "environment %s: %w", e.Name, err))
+			}
+		}
+	}
+	// Environments are looked up by name, so the graph can only be checked with unique names
+	if unique && cfg.PRFlow != PRFlowTypePerEnv {
+		for i, e := range cfg.Environments {
+			if len(cfg.NextEnvironments(e.Name)) > 1 {
+				errs = append(errs, newValidationError(appendPath(path, strconv.Itoa(i)),
+					"environment %s has more than one next environment, which requires prflow %s", e.Name, PRFlowTypePerEnv))
+			}
+		}
+	}
+	return errs
+}
+
+// validateGroups checks the environments of the groups that override them and their applications.
+func validateGroups(cfg Config) []error {
+	errs := []error{}
+	for _, name := range cfg.GroupNames() {
+		group := cfg.Groups[name]
+		if len(group.Environments) > 0 {
+			for _, err := range validateEnvironments(cfg.ForGroup(name), []string{"groups", name, "environments"}) {
+				var validationErr *ValidationError
+				errors.As(err, &validationErr)
+				errs = append(errs, newValidationError(validationErr.Path, "group %s: %w", name, validationErr.Err))
+			}
+		}
+		for _, app := range sortedAppNames(group.Applications) {
+			errs = append(errs, validateApp(cfg, name, app)...)
+		}
+	}
+	return errs
+}
+
+// validateApp checks the feature label selector of the application and that its policy only
+// refers to environments of its group.
+func validateApp(cfg Config, group, name string) []error {
+	errs := []error{}
+	app := cfg.Groups[group].Applications[name]
+	path := []string{"groups", group, "applications", name}
+	if app.FeatureLabelSelector != nil {
+		if len(app.FeatureLabelSelector) == 0 {
+			errs = append(errs, newValidationError(appendPath(path, "featureLabelSelector"),
+				"featureLabelSelector of %s/%s cannot be empty", group, name))
+		} else if _, err := labels.ValidatedSelectorFromSet(app.FeatureLabelSelector); err != nil {
+			errs = append(errs, newValidationError(appendPath(path, "featureLabelSelector"),
+				"invalid featureLabelSelector of %s/%s: %s", group, name, strings.ReplaceAll(err.Error(), "\n", " ")))
+		}
+	}
+
+	groupCfg := cfg.ForGroup(group)
+	for i, env := range app.Environments {
+		if _, _, err := groupCfg.getEnvironment(env); err != nil {
+			errs = append(errs, newValidationError(appendPath(path, "environments", strconv.Itoa(i)),
+				"application %s/%s has unknown environment %s", group, name, env))
+		}
+	}
+	if app.StopAt != "" {
+		if _, _, err := groupCfg.getEnvironment(app.StopAt); err != nil {
+			errs = append(errs, newValidationError(appendPath(path, "stopAt"),
+				"application %s/%s stops at unknown environment %s", group, name, app.StopAt))
+		}
+	}
+	for _, env := range sortedKeys(app.Auto) {
+		if _, _, err := groupCfg.getEnvironment(env); err != nil {
+			errs = append(errs, newValidationError(appendPath(path, "auto", env),
+				"application %s/%s has auto for unknown environment %s", group, name, env))
+		}
+	}
+	if len(errs) == 0 {
+		errs = append(errs, validateAppEnvironments(cfg, group, name, path)...)
+	}
+	if app.HelmRelease != nil {
+		errs = append(errs, validateHelmRelease(*app.HelmRelease, group, name, appendPath(path, "helmRelease"))...)
+	}
+	return errs
+}
+
+// validateAppEnvironments checks that the environments left for the application after its policy
+// is applied form a graph with a single first environment. Skipping environments that are not on
+// the same path through the graph could otherwise leave several environments without a previous one.
+func validateAppEnvironments(cfg Config, group, name string, path []string) []error {
+	groupCfg := cfg.ForGroup(group)
+	// Problems with the environments of the group are reported for the group
+	if len(validateEnvironments(groupCfg, nil)) > 0 {
+		return nil
+	}
+	app := cfg.Groups[group].Applications[name]
+	if roots := groupCfg.appRootEnvironmentNames(app); len(roots) > 1 {
+		return []error{newValidationError(path, "application %s/%s has more than one first environment: %s",
+			group, name, strings.Join(roots, ", "))}
+	}
+	appCfg := cfg.ForApp(group, name)
+	if len(appCfg.Environments) == 0 {
+		return []error{newValidationError(path, "application %s/%s is not promoted to any environment", group, name)}
+	}
+	errs := []error{}
+	for _, err := range validateEnvironments(appCfg, path) {
+		var validationErr *ValidationError
+		errors.As(err, &validationErr)
+		errs = append(errs, newValidationError(path, "application %s/%s: %w", group, name, validationErr.Err))
+	}
+	return errs
+}
+
+func validateHelmRelease(hr HelmRelease, group, name string, path []string) []error {
+	errs := []error{}
+	if (hr.Name == "") == (hr.ValuesFile == "") {
+		errs = append(errs, newValidationError(path, "helmRelease of %s/%s requires exactly one of name or valuesFile", group, name))
+	}
+	if hr.ValuesFile != "" && (filepath.IsAbs(hr.ValuesFile) || strings.HasPrefix(filepath.Clean(hr.ValuesFile), "..")) {
+		errs = append(errs, newValidationError(appendPath(path, "valuesFile"),
+			"valuesFile %s of %s/%s has to be inside the environment directory", hr.ValuesFile, group, name))
+	}
+	for _, field := range hr.GetValuesPath() {
+		if field == "" {
+			errs = append(errs, newValidationError(appendPath(path, "valuesPath"),
+				"invalid valuesPath %q of %s/%s", hr.ValuesPath, group, name))
+			break
+		}
+	}
+	return errs
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateTemplates(cfg Config) []error {
+	templates := []struct {
+		name string
+		path []string
+		text string
+	}{
+		{"commit message", []string{"commit", "message"}, cfg.Commit.Message},
+		{"pull request title", []string{"pullRequest", "title"}, cfg.PullRequest.Title},
+		{"pull request description", []string{"pullRequest", "description"}, cfg.PullRequest.Description},
+	}
+	errs := []error{}
+	for _, t := range templates {
+		_, err := template.New(t.name).Parse(t.text)
+		if err != nil {
+			errs = append(errs, newValidationError(t.path, "invalid %s template: %w", t.name, err))
+		}
+	}
+	return errs
+}
+
+// appendPath returns a new path with the elements appended, leaving the original path untouched.
+func appendPath(path []string, elems ...string) []string {
+	result := make([]string, 0, len(path)+len(elems))
+	result = append(result, path...)
+	return append(result, elems...)
+}
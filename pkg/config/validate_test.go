@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigStrict(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{
+			name: "unknown key",
+			data: `
+environments:
+  - name: dev
+    automated: true
+`,
+			message: "line 4: field automated not found in type config.Environment",
+		},
+		{
+			name: "duplicate key",
+			data: `
+environments:
+  - name: dev
+prflow: per-env
+prflow: per-app
+`,
+			message: "line 5: field prflow already set in type config.Config",
+		},
+		{
+			name: "duplicate environment",
+			data: `
+environments:
+  - name: dev
+  - name: dev
+`,
+			message: "environment dev is declared more than once",
+		},
+		{
+			name: "empty feature label selector",
+			data: `
+environments:
+  - name: dev
+groups:
+  apps:
+    applications:
+      podinfo:
+        featureLabelSelector: {}
+`,
+			message: "featureLabelSelector of apps/podinfo cannot be empty",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := LoadConfig(bytes.NewReader([]byte(c.data)))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.message)
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	data := `prflow: per-app
+environments:
+  - name: dev
+    auto: true
+  - name: qa
+    after: [prod]
+  - name: prod
+    auto: false
+groups:
+  apps:
+    applications:
+      podinfo:
+        featureLabelSelector:
+          app: "pod info"
+commit:
+  author:
+    name: bot
+`
+	problems := ValidateConfig(memFs(t, map[string]string{"gitops-promotion.yaml": data}), "gitops-promotion.yaml", func(cfg Config) []error {
+		return []error{
+			&ValidationError{Path: []string{"groups", "apps"}, Err: errors.New("directory apps/dev does not exist")},
+			errors.New("something else"),
+		}
+	})
+	lines := []string{}
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	require.Len(t, lines, 5)
+	require.Equal(t, "gitops-promotion.yaml:6: environment qa is after prod which is not declared before it", lines[0])
+	require.Contains(t, lines[1], "gitops-promotion.yaml:13: invalid featureLabelSelector of apps/podinfo")
+	require.Equal(t, "gitops-promotion.yaml:16: commit author requires both name and email", lines[2])
+	require.Equal(t, "gitops-promotion.yaml:10: directory apps/dev does not exist", lines[3])
+	require.Equal(t, "gitops-promotion.yaml: something else", lines[4])
+}
+
+func TestValidateConfigDecodeErrors(t *testing.T) {
+	data := `environments:
+  - name: dev
+    automated: true
+  - name: qa
+    foo: bar
+`
+	problems := ValidateConfig(memFs(t, map[string]string{"gitops-promotion.yaml": data}), "gitops-promotion.yaml")
+	require.Equal(t, []Problem{
+		{File: "gitops-promotion.yaml", Line: 3, Message: "field automated not found in type config.Environment"},
+		{File: "gitops-promotion.yaml", Line: 5, Message: "field foo not found in type config.Environment"},
+	}, problems)
+
+	problems = ValidateConfig(memFs(t, map[string]string{"gitops-promotion.yaml": "environments: [\n"}), "gitops-promotion.yaml")
+	require.Len(t, problems, 1)
+	require.Equal(t, 1, problems[0].Line)
+}
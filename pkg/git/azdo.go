@@ -22,40 +22,12 @@ type AzdoGITProvider struct {
 
 // NewAdoGITProvider ...
 func NewAzdoGITProvider(ctx context.Context, remoteURL, token string) (*AzdoGITProvider, error) {
-	host, id, err := ParseGitAddress(remoteURL)
+	orgURL, proj, repo, err := parseAzdoAddress(remoteURL)
 	if err != nil {
 		return nil, err
 	}
 
-	var org string
-	var proj string
-	var repo string
-	if host == "https://dev.azure.com" {
-		comp := strings.Split(id, "/")
-		if len(comp) != 4 {
-			return nil, fmt.Errorf("invalid repository id %q", id)
-		}
-		org = comp[0]
-		proj = comp[1]
-		repo = comp[3]
-	} else {
-		comp := strings.Split(id, "/")
-		if len(comp) != 3 {
-			return nil, fmt.Errorf("invalid repository id %q", id)
-		}
-		proj = comp[0]
-		repo = comp[2]
-
-		u, err := url.Parse(host)
-		if err != nil {
-			return nil, err
-		}
-		comp = strings.Split(u.Hostname(), ".")
-		org = comp[0]
-		host = "https://dev.azure.com"
-	}
-
-	connection := azuredevops.NewPatConnection(fmt.Sprintf("%s/%s", host, org), token)
+	connection := azuredevops.NewPatConnection(orgURL, token)
 	client, err := git.NewClient(ctx, connection)
 	if err != nil {
 		return nil, err
@@ -67,10 +39,58 @@ func NewAzdoGITProvider(ctx context.Context, remoteURL, token string) (*AzdoGITP
 	}, nil
 }
 
+// parseAzdoAddress returns the organization (or collection) URL, project and repository
+// of an Azure DevOps Services or Azure DevOps Server remote URL.
+func parseAzdoAddress(remoteURL string) (string, string, string, error) {
+	host, id, err := ParseGitAddress(remoteURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	comp := strings.Split(id, "/")
+	hostname := u.Hostname()
+	switch {
+	case hostname == "ssh.dev.azure.com" || hostname == "vs-ssh.visualstudio.com":
+		// ssh://git@ssh.dev.azure.com/v3/<org>/<project>/<repo>
+		if len(comp) != 4 || comp[0] != "v3" {
+			return "", "", "", fmt.Errorf("invalid repository id %q", id)
+		}
+		return fmt.Sprintf("https://dev.azure.com/%s", comp[1]), comp[2], comp[3], nil
+	case hostname == "dev.azure.com":
+		// https://dev.azure.com/<org>/<project>/_git/<repo>
+		if len(comp) != 4 || comp[2] != "_git" {
+			return "", "", "", fmt.Errorf("invalid repository id %q", id)
+		}
+		return fmt.Sprintf("%s/%s", host, comp[0]), comp[1], comp[3], nil
+	case strings.HasSuffix(hostname, ".visualstudio.com"):
+		// https://<org>.visualstudio.com/[DefaultCollection/]<project>/_git/<repo>
+		if len(comp) == 4 && comp[0] == "DefaultCollection" {
+			comp = comp[1:]
+		}
+		if len(comp) != 3 || comp[1] != "_git" {
+			return "", "", "", fmt.Errorf("invalid repository id %q", id)
+		}
+		org := strings.Split(hostname, ".")[0]
+		return fmt.Sprintf("https://dev.azure.com/%s", org), comp[0], comp[2], nil
+	default:
+		// Azure DevOps Server serves each collection under its own path, which may be
+		// behind a virtual directory: https://<host>/[tfs/]<collection>/<project>/_git/<repo>
+		if len(comp) < 4 || comp[len(comp)-2] != "_git" {
+			return "", "", "", fmt.Errorf("invalid repository id %q", id)
+		}
+		collection := strings.Join(comp[:len(comp)-3], "/")
+		return fmt.Sprintf("%s/%s", host, collection), comp[len(comp)-3], comp[len(comp)-1], nil
+	}
+}
+
 // CreatePR ...
-func (g *AzdoGITProvider) CreatePR(ctx context.Context, branchName string, auto bool, title, description string) (int, error) {
+func (g *AzdoGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
 	sourceRefName := fmt.Sprintf("refs/heads/%s", branchName)
-	targetRefName := fmt.Sprintf("refs/heads/%s", DefaultBranch)
+	targetRefName := fmt.Sprintf("refs/heads/%s", targetBranch)
 
 	// Update PR if it already exists
 	getArgs := git.GetPullRequestsArgs{
@@ -0,0 +1,103 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAzdoAddress(t *testing.T) {
+	cases := []struct {
+		input         string
+		expectedOrg   string
+		expectedProj  string
+		expectedRepo  string
+		expectedError string
+	}{
+		{
+			input:        "https://dev.azure.com/organization/project/_git/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "https://organization@dev.azure.com/organization/project/_git/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "git@ssh.dev.azure.com:v3/organization/project/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "https://organization.visualstudio.com/project/_git/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "https://organization.visualstudio.com/DefaultCollection/project/_git/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "organization@vs-ssh.visualstudio.com:v3/organization/project/repository",
+			expectedOrg:  "https://dev.azure.com/organization",
+			expectedProj: "project",
+			expectedRepo: "repository",
+		},
+		{
+			input:        "https://tfs.corp.local/tfs/DefaultCollection/Project/_git/repo",
+			expectedOrg:  "https://tfs.corp.local/tfs/DefaultCollection",
+			expectedProj: "Project",
+			expectedRepo: "repo",
+		},
+		{
+			input:        "http://tfs.corp.local:8080/tfs/DefaultCollection/Project/_git/repo",
+			expectedOrg:  "http://tfs.corp.local:8080/tfs/DefaultCollection",
+			expectedProj: "Project",
+			expectedRepo: "repo",
+		},
+		{
+			input:        "https://azdo.corp.local/DefaultCollection/Project/_git/repo",
+			expectedOrg:  "https://azdo.corp.local/DefaultCollection",
+			expectedProj: "Project",
+			expectedRepo: "repo",
+		},
+		{
+			input:        "ssh://azdo.corp.local:22/tfs/DefaultCollection/Project/_git/repo",
+			expectedOrg:  "https://azdo.corp.local/tfs/DefaultCollection",
+			expectedProj: "Project",
+			expectedRepo: "repo",
+		},
+		{
+			input:         "https://dev.azure.com/organization/project/repository",
+			expectedError: "invalid repository id \"organization/project/repository\"",
+		},
+		{
+			input:         "https://organization.visualstudio.com/repository",
+			expectedError: "invalid repository id \"repository\"",
+		},
+		{
+			input:         "https://tfs.corp.local/Project/_git/repo",
+			expectedError: "invalid repository id \"Project/_git/repo\"",
+		},
+	}
+
+	for _, c := range cases {
+		org, proj, repo, err := parseAzdoAddress(c.input)
+		if c.expectedError != "" {
+			require.EqualError(t, err, c.expectedError, c.input)
+			continue
+		}
+
+		require.NoError(t, err, c.input)
+		require.Equal(t, c.expectedOrg, org, c.input)
+		require.Equal(t, c.expectedProj, proj, c.input)
+		require.Equal(t, c.expectedRepo, repo, c.input)
+	}
+}
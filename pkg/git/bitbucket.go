@@ -0,0 +1,438 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // used for the build status key, not for security
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+)
+
+// BitbucketServerGITProvider ...
+type BitbucketServerGITProvider struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	project string
+	repo    string
+}
+
+type bitbucketProject struct {
+	Key string `json:"key"`
+}
+
+type bitbucketRepository struct {
+	Slug    string           `json:"slug"`
+	Project bitbucketProject `json:"project"`
+}
+
+type bitbucketRef struct {
+	ID           string               `json:"id"`
+	DisplayID    string               `json:"displayId,omitempty"`
+	LatestCommit string               `json:"latestCommit,omitempty"`
+	Repository   *bitbucketRepository `json:"repository,omitempty"`
+}
+
+type bitbucketPullRequest struct {
+	ID          int          `json:"id,omitempty"`
+	Version     int          `json:"version"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	State       string       `json:"state,omitempty"`
+	FromRef     bitbucketRef `json:"fromRef"`
+	ToRef       bitbucketRef `json:"toRef"`
+	Properties  struct {
+		MergeCommit *struct {
+			ID string `json:"id"`
+		} `json:"mergeCommit,omitempty"`
+	} `json:"properties"`
+}
+
+type bitbucketPullRequestPage struct {
+	Values        []bitbucketPullRequest `json:"values"`
+	IsLastPage    bool                   `json:"isLastPage"`
+	NextPageStart int                    `json:"nextPageStart"`
+}
+
+type bitbucketBuildStatus struct {
+	State       string `json:"state"`
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+type bitbucketBuildStatusPage struct {
+	Values []bitbucketBuildStatus `json:"values"`
+}
+
+type bitbucketError struct {
+	StatusCode int
+	Errors     []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *bitbucketError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Message)
+	}
+	return fmt.Sprintf("bitbucket responded with status %d: %s", e.StatusCode, strings.Join(msgs, ", "))
+}
+
+const (
+	bitbucketStateOpen       = "OPEN"
+	bitbucketStateMerged     = "MERGED"
+	bitbucketBuildSuccessful = "SUCCESSFUL"
+	bitbucketBuildFailed     = "FAILED"
+)
+
+// NewBitbucketServerGITProvider ...
+func NewBitbucketServerGITProvider(ctx context.Context, remoteURL, token string) (*BitbucketServerGITProvider, error) {
+	if remoteURL == "" {
+		return nil, fmt.Errorf("remoteURL empty")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token empty")
+	}
+
+	host, project, repo, err := parseBitbucketAddress(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BitbucketServerGITProvider{
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: strings.TrimSuffix(host, "/"),
+		token:   token,
+		project: project,
+		repo:    repo,
+	}, nil
+}
+
+// parseBitbucketAddress returns the server URL, project and repository of a Bitbucket Server
+// remote URL. Repositories are served over http under /scm/<project>/<repo>, optionally behind
+// a context path which is part of the server URL, and over ssh under /<project>/<repo>.
+func parseBitbucketAddress(remoteURL string) (string, string, string, error) {
+	host, id, err := ParseGitAddress(remoteURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	if i := strings.Index("/"+id, "/scm/"); i >= 0 {
+		if i > 0 {
+			host = fmt.Sprintf("%s/%s", host, id[:i-1])
+		}
+		id = id[i+len("scm/"):]
+	}
+
+	comp := strings.Split(id, "/")
+	if len(comp) != 2 {
+		return "", "", "", fmt.Errorf("invalid repository id %q", id)
+	}
+	return host, comp[0], comp[1], nil
+}
+
+// CreatePR ...
+func (g *BitbucketServerGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
+	sourceName := branchName
+	targetName := targetBranch
+
+	openPrs, err := g.listPRs(ctx, sourceName, targetName, bitbucketStateOpen)
+	if err != nil {
+		return 0, err
+	}
+
+	var pr bitbucketPullRequest
+	switch len(openPrs) {
+	case 0:
+		repository := &bitbucketRepository{Slug: g.repo, Project: bitbucketProject{Key: g.project}}
+		newPr := bitbucketPullRequest{
+			Title:       title,
+			Description: description,
+			FromRef:     bitbucketRef{ID: "refs/heads/" + sourceName, Repository: repository},
+			ToRef:       bitbucketRef{ID: "refs/heads/" + targetName, Repository: repository},
+		}
+		err = g.do(ctx, http.MethodPost, g.repoPath("pull-requests"), nil, newPr, &pr)
+		if err == nil {
+			log.Printf("Created new PR #%d merging %s -> %s\n", pr.ID, sourceName, targetName)
+		}
+	case 1:
+		update := struct {
+			Version     int    `json:"version"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		}{
+			Version:     openPrs[0].Version,
+			Title:       title,
+			Description: description,
+		}
+		err = g.do(ctx, http.MethodPut, g.repoPath(fmt.Sprintf("pull-requests/%d", openPrs[0].ID)), nil, update, &pr)
+		if err == nil {
+			log.Printf("Updated PR #%d merging %s -> %s\n", pr.ID, sourceName, targetName)
+		}
+	default:
+		return 0, fmt.Errorf("received more than one PRs when listing: %d", len(openPrs))
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if auto {
+		// Auto-merge is only available in Bitbucket Data Center 8.15 or later, older
+		// versions do not know about the endpoint and the PR has to be merged by hand.
+		err = g.do(ctx, http.MethodPost, g.repoPath(fmt.Sprintf("pull-requests/%d/auto-merge", pr.ID)), nil, nil, nil)
+		var bbErr *bitbucketError
+		switch {
+		case err == nil:
+			log.Printf("Auto-merge activated for PR #%d\n", pr.ID)
+		case errors.As(err, &bbErr) && bbErr.StatusCode == http.StatusNotFound:
+			log.Printf("Auto-merge is not available on this Bitbucket server, PR #%d has to be merged manually\n", pr.ID)
+		case errors.As(err, &bbErr) && bbErr.StatusCode == http.StatusConflict:
+			log.Printf("Auto-merge already activated for PR #%d\n", pr.ID)
+		default:
+			log.Printf("Failed to activate auto-merge for PR #%d: %v", pr.ID, err)
+			return 0, fmt.Errorf("could not set auto-merge on PR #%d: %w", pr.ID, err)
+		}
+	}
+	return pr.ID, nil
+}
+
+func (g *BitbucketServerGITProvider) GetStatus(ctx context.Context, sha string, group string, env string) (CommitStatus, error) {
+	query := url.Values{}
+	query.Set("orderBy", "NEWEST")
+	query.Set("limit", "100")
+	page := bitbucketBuildStatusPage{}
+	err := g.do(ctx, http.MethodGet, fmt.Sprintf("/rest/build-status/1.0/commits/%s", sha), query, nil, &page)
+	if err != nil {
+		return CommitStatus{}, err
+	}
+	var displays = make([]string, len(page.Values))
+	for i := range page.Values {
+		s := page.Values[i]
+		displays = append(displays, fmt.Sprintf("%s: %s (%s)", s.Name, s.State, s.Description))
+	}
+	log.Printf("Considering statuses %v\n", displays)
+
+	// The Flux notification controller uses a hash as the build status key, as the
+	// key is limited to 40 characters, so the status is matched on the name instead.
+	name := fmt.Sprintf("%s-%s", group, env)
+	for _, s := range page.Values {
+		comp := strings.Split(s.Name, "/")
+		if len(comp) < 2 {
+			return CommitStatus{}, fmt.Errorf("build status name in wrong format: %q", s.Name)
+		}
+		if comp[1] == name {
+			return CommitStatus{
+				Succeeded: s.State == bitbucketBuildSuccessful,
+			}, nil
+		}
+	}
+	return CommitStatus{}, fmt.Errorf("no status found for sha %q", sha)
+}
+
+func (g *BitbucketServerGITProvider) SetStatus(ctx context.Context, sha string, group string, env string, succeeded bool) error {
+	description := fmt.Sprintf("%s-%s-%s", group, env, sha)
+	name := fmt.Sprintf("kind/%s-%s", group, env)
+
+	state := bitbucketBuildSuccessful
+	if !succeeded {
+		state = bitbucketBuildFailed
+	}
+
+	//nolint:gosec // the key only has to be unique, not secure
+	key := sha1.Sum([]byte(name))
+	status := bitbucketBuildStatus{
+		State:       state,
+		Key:         hex.EncodeToString(key[:]),
+		Name:        name,
+		URL:         fmt.Sprintf("%s/projects/%s/repos/%s/commits/%s", g.baseURL, g.project, g.repo, sha),
+		Description: description,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return g.do(ctx, http.MethodPost, g.repoPath(fmt.Sprintf("commits/%s/builds", sha)), nil, status, nil)
+}
+
+func (g *BitbucketServerGITProvider) MergePR(ctx context.Context, id int, sha string) error {
+	path := g.repoPath(fmt.Sprintf("pull-requests/%d", id))
+
+	var pr bitbucketPullRequest
+	err := retry.Do(
+		func() error {
+			current := bitbucketPullRequest{}
+			err := g.do(ctx, http.MethodGet, path, nil, nil, &current)
+			if err != nil {
+				return err
+			}
+			// Bitbucket merges whatever the PR points at, so make sure nothing has been pushed since.
+			if current.FromRef.LatestCommit != sha {
+				return retry.Unrecoverable(fmt.Errorf("PR with ID %d has head %s, expected %s", id, current.FromRef.LatestCommit, sha))
+			}
+			query := url.Values{}
+			query.Set("version", fmt.Sprint(current.Version))
+			// Bitbucket responds with 409 while the PR is not mergeable yet.
+			return g.do(ctx, http.MethodPost, path+"/merge", query, nil, &pr)
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if pr.State != bitbucketStateMerged {
+		return fmt.Errorf("PR with ID %d was not merged: %s", id, pr.State)
+	}
+
+	return nil
+}
+
+func (g *BitbucketServerGITProvider) GetPRWithBranch(ctx context.Context, source, target string) (PullRequest, error) {
+	var prs []bitbucketPullRequest
+	err := retry.Do(
+		func() error {
+			var err error
+			prs, err = g.listPRs(ctx, source, target, bitbucketStateOpen)
+			if err != nil {
+				return err
+			}
+			if len(prs) != 1 {
+				return fmt.Errorf("no PR found for branches %q-%q", source, target)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	pr := prs[0]
+
+	return NewPullRequest(&pr.ID, &pr.Title, &pr.Description)
+}
+
+func (g *BitbucketServerGITProvider) GetPRThatCausedCommit(ctx context.Context, sha string) (PullRequest, error) {
+	var prs []bitbucketPullRequest
+	err := retry.Do(
+		func() error {
+			page := bitbucketPullRequestPage{}
+			err := g.do(ctx, http.MethodGet, g.repoPath(fmt.Sprintf("commits/%s/pull-requests", sha)), nil, nil, &page)
+			if err != nil {
+				return err
+			}
+			prs = nil
+			for _, pr := range page.Values {
+				if pr.State != bitbucketStateMerged {
+					continue
+				}
+				// The commit is either the merge commit or the head of a fast-forwarded source branch.
+				mergeCommit := pr.Properties.MergeCommit
+				if (mergeCommit != nil && mergeCommit.ID == sha) || pr.FromRef.LatestCommit == sha {
+					prs = append(prs, pr)
+				}
+			}
+			if len(prs) != 1 {
+				return fmt.Errorf("no PR found for sha: %s", sha)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	pr := prs[0]
+
+	return NewPullRequest(&pr.ID, &pr.Title, &pr.Description)
+}
+
+func (g *BitbucketServerGITProvider) listPRs(ctx context.Context, source, target, state string) ([]bitbucketPullRequest, error) {
+	query := url.Values{}
+	query.Set("state", state)
+	query.Set("direction", "OUTGOING")
+	query.Set("at", "refs/heads/"+source)
+	query.Set("limit", "100")
+
+	result := []bitbucketPullRequest{}
+	for {
+		page := bitbucketPullRequestPage{}
+		err := g.do(ctx, http.MethodGet, g.repoPath("pull-requests"), query, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range page.Values {
+			if pr.ToRef.ID == "refs/heads/"+target {
+				result = append(result, pr)
+			}
+		}
+		if page.IsLastPage || len(page.Values) == 0 {
+			return result, nil
+		}
+		query.Set("start", fmt.Sprint(page.NextPageStart))
+	}
+}
+
+func (g *BitbucketServerGITProvider) repoPath(path string) string {
+	return fmt.Sprintf("/rest/api/1.0/projects/%s/repos/%s/%s", url.PathEscape(g.project), url.PathEscape(g.repo), path)
+}
+
+// do sends a request to the Bitbucket REST API and decodes the response into out.
+func (g *BitbucketServerGITProvider) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	u := g.baseURL + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		bbErr := &bitbucketError{StatusCode: res.StatusCode}
+		//nolint:errcheck // the error body is optional
+		_ = json.NewDecoder(res.Body).Decode(bbErr)
+		return bbErr
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,327 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// bitbucketStandIn keeps the pull requests of PROJ/repo and build statuses in memory, and serves
+// them like Bitbucket Server behind the /bitbucket context path. Every request has to use the
+// token "token". Pull requests are versioned, so updates and merges with a stale version conflict.
+// Setting autoMergeMissing makes the auto-merge endpoint unavailable, as on servers before 8.15.
+type bitbucketStandIn struct {
+	standInRouter
+	prs              []*bitbucketPullRequest
+	statuses         map[string][]bitbucketBuildStatus
+	autoMerge        map[int]bool
+	autoMergeMissing bool
+}
+
+func newBitbucketStandIn() *bitbucketStandIn {
+	s := &bitbucketStandIn{
+		statuses:  map[string][]bitbucketBuildStatus{},
+		autoMerge: map[int]bool{},
+	}
+	prefix := "/bitbucket/rest/api/1.0/projects/PROJ/repos/repo"
+	s.handle(http.MethodGet, "/bitbucket/rest/build-status/1.0/commits/*", s.listBuildStatuses)
+	s.handle(http.MethodGet, prefix+"/pull-requests", s.listPullRequests)
+	s.handle(http.MethodPost, prefix+"/pull-requests", s.createPullRequest)
+	s.handle(http.MethodGet, prefix+"/pull-requests/*", s.getPullRequest)
+	s.handle(http.MethodPut, prefix+"/pull-requests/*", s.updatePullRequest)
+	s.handle(http.MethodPost, prefix+"/pull-requests/*/auto-merge", s.enableAutoMerge)
+	s.handle(http.MethodPost, prefix+"/pull-requests/*/merge", s.mergePullRequest)
+	s.handle(http.MethodGet, prefix+"/commits/*/pull-requests", s.listCommitPullRequests)
+	s.handle(http.MethodPost, prefix+"/commits/*/builds", s.addBuildStatus)
+	return s
+}
+
+func (s *bitbucketStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"errors": []map[string]string{{"message": "unauthorized"}}})
+		return
+	}
+	s.standInRouter.ServeHTTP(w, r)
+}
+
+func (s *bitbucketStandIn) listBuildStatuses(w http.ResponseWriter, _ *http.Request, params []string) {
+	statuses := s.statuses[params[0]]
+	if statuses == nil {
+		statuses = []bitbucketBuildStatus{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"values": statuses, "isLastPage": true})
+}
+
+func (s *bitbucketStandIn) listPullRequests(w http.ResponseWriter, r *http.Request, _ []string) {
+	q := r.URL.Query()
+	result := []*bitbucketPullRequest{}
+	for _, pr := range s.prs {
+		if pr.State == q.Get("state") && pr.FromRef.ID == q.Get("at") {
+			result = append(result, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"values": result, "isLastPage": true})
+}
+
+func (s *bitbucketStandIn) createPullRequest(w http.ResponseWriter, r *http.Request, _ []string) {
+	pr := &bitbucketPullRequest{}
+	readJSON(r, pr)
+	pr.ID = len(s.prs) + 1
+	pr.State = bitbucketStateOpen
+	pr.FromRef.LatestCommit = fmt.Sprintf("%040d", pr.ID)
+	s.prs = append(s.prs, pr)
+	writeJSON(w, http.StatusCreated, pr)
+}
+
+func (s *bitbucketStandIn) getPullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	if i := standInLookup(w, r, params[0], len(s.prs)); i >= 0 {
+		writeJSON(w, http.StatusOK, s.prs[i])
+	}
+}
+
+func (s *bitbucketStandIn) updatePullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.prs))
+	if i < 0 {
+		return
+	}
+	pr := s.prs[i]
+	update := bitbucketPullRequest{}
+	readJSON(r, &update)
+	if update.Version != pr.Version {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"errors": []map[string]string{{"message": "stale version"}}})
+		return
+	}
+	pr.Title = update.Title
+	pr.Description = update.Description
+	pr.Version++
+	writeJSON(w, http.StatusOK, pr)
+}
+
+func (s *bitbucketStandIn) enableAutoMerge(w http.ResponseWriter, r *http.Request, params []string) {
+	if s.autoMergeMissing {
+		http.NotFound(w, r)
+		return
+	}
+	id, _ := strconv.Atoi(params[0])
+	s.autoMerge[id] = true
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *bitbucketStandIn) mergePullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.prs))
+	if i < 0 {
+		return
+	}
+	pr := s.prs[i]
+	if r.URL.Query().Get("version") != fmt.Sprint(pr.Version) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"errors": []map[string]string{{"message": "stale version"}}})
+		return
+	}
+	pr.State = bitbucketStateMerged
+	pr.Properties.MergeCommit = &struct {
+		ID string `json:"id"`
+	}{ID: fmt.Sprintf("%040d", 1000+pr.ID)}
+	writeJSON(w, http.StatusOK, pr)
+}
+
+func (s *bitbucketStandIn) listCommitPullRequests(w http.ResponseWriter, _ *http.Request, params []string) {
+	result := []*bitbucketPullRequest{}
+	for _, pr := range s.prs {
+		if pr.FromRef.LatestCommit == params[0] || (pr.Properties.MergeCommit != nil && pr.Properties.MergeCommit.ID == params[0]) {
+			result = append(result, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"values": result, "isLastPage": true})
+}
+
+func (s *bitbucketStandIn) addBuildStatus(w http.ResponseWriter, r *http.Request, params []string) {
+	status := bitbucketBuildStatus{}
+	readJSON(r, &status)
+	s.statuses[params[0]] = append([]bitbucketBuildStatus{status}, s.statuses[params[0]]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var _ = Describe("NewBitbucketServerGITProvider", func() {
+	var err error
+	var ctx context.Context
+
+	BeforeEach(func() {
+		err = nil
+		ctx = context.Background()
+	})
+
+	It("returns error when creating without url", func() {
+		_, err = NewBitbucketServerGITProvider(ctx, "", "foo")
+		Expect(err).To(MatchError("remoteURL empty"))
+	})
+
+	It("returns error when creating without token", func() {
+		_, err = NewBitbucketServerGITProvider(ctx, "https://bitbucket.example.com/scm/proj/repo.git", "")
+		Expect(err).To(MatchError("token empty"))
+	})
+
+	It("returns error when creating with an invalid repository id", func() {
+		_, err = NewBitbucketServerGITProvider(ctx, "https://bitbucket.example.com/scm/repo.git", "foo")
+		Expect(err).To(MatchError("invalid repository id \"repo\""))
+	})
+
+	It("is successfully created from an ssh address", func() {
+		var provider *BitbucketServerGITProvider
+		provider, err = NewBitbucketServerGITProvider(ctx, "ssh://git@bitbucket.example.com:7999/proj/repo.git", "foo")
+		Expect(err).To(BeNil())
+		Expect(provider.baseURL).To(Equal("https://bitbucket.example.com"))
+		Expect(provider.project).To(Equal("proj"))
+		Expect(provider.repo).To(Equal("repo"))
+	})
+
+	It("is successfully created from an http address with a context path", func() {
+		var provider *BitbucketServerGITProvider
+		provider, err = NewBitbucketServerGITProvider(ctx, "https://user@example.com/bitbucket/scm/proj/repo.git", "foo")
+		Expect(err).To(BeNil())
+		Expect(provider.baseURL).To(Equal("https://example.com/bitbucket"))
+		Expect(provider.project).To(Equal("proj"))
+		Expect(provider.repo).To(Equal("repo"))
+	})
+})
+
+var _ = Describe("BitbucketServerGITProvider", func() {
+	var ctx context.Context
+	var standIn *bitbucketStandIn
+	var server *httptest.Server
+	var provider *BitbucketServerGITProvider
+	state := &PRState{
+		Env:   "dev",
+		Group: "testgroup",
+		App:   "testapp",
+		Tag:   "v1.0.0",
+		Sha:   "",
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		standIn = newBitbucketStandIn()
+		server = httptest.NewServer(standIn)
+		var err error
+		provider, err = NewBitbucketServerGITProvider(ctx, fmt.Sprintf("%s/bitbucket/scm/PROJ/repo.git", server.URL), "token")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	createPR := func(branchName string, auto bool) (int, error) {
+		description, err := state.Description()
+		Expect(err).To(BeNil())
+		return provider.CreatePR(ctx, branchName, DefaultBranch, auto, state.Title(), description)
+	}
+
+	Describe("CreatePR", func() {
+		It("creates a new PR", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(1))
+			Expect(standIn.prs).To(HaveLen(1))
+			Expect(standIn.prs[0].ToRef.ID).To(Equal("refs/heads/" + DefaultBranch))
+			Expect(standIn.prs[0].FromRef.Repository.Project.Key).To(Equal("PROJ"))
+			Expect(standIn.autoMerge).To(BeEmpty())
+		})
+
+		It("updates an existing PR for the same branch", func() {
+			origID, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			standIn.prs[0].Title = "old title"
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(origID))
+			Expect(standIn.prs).To(HaveLen(1))
+			Expect(standIn.prs[0].Title).To(Equal(state.Title()))
+		})
+
+		It("enables auto-merge when auto is true", func() {
+			id, err := createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+			Expect(standIn.autoMerge[id]).To(BeTrue())
+		})
+
+		It("creates the PR when the server does not support auto-merge", func() {
+			standIn.autoMergeMissing = true
+			_, err := createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+			Expect(standIn.prs).To(HaveLen(1))
+		})
+	})
+
+	Describe("GetStatus", func() {
+		sha := fmt.Sprintf("%040d", 42)
+
+		It("returns an error when there is no status", func() {
+			_, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(MatchError(fmt.Sprintf("no status found for sha %q", sha)))
+		})
+
+		It("reports the latest status", func() {
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeFalse())
+
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, true)).To(Succeed())
+			status, err = provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+			Expect(standIn.statuses[sha][0].Key).To(HaveLen(40))
+		})
+
+		It("matches statuses set by the Flux notification controller", func() {
+			standIn.statuses[sha] = []bitbucketBuildStatus{
+				{Key: "0e5aa3ba9b8b0d1a1a0c1f6a2d2a8c7a3a9b9a7e", Name: "kustomization/testgroup-qa", State: bitbucketBuildFailed},
+				{Key: "a3c5c4e6b0d84b1a6e0e2f3a6b2b7c9d1e0f4a5b", Name: "kustomization/testgroup-dev", State: bitbucketBuildSuccessful},
+			}
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+	})
+
+	Describe("GetPRWithBranch", func() {
+		It("returns the PR with its state", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			pr, err := provider.GetPRWithBranch(ctx, "promote/testgroup-testapp", DefaultBranch)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+	})
+
+	Describe("MergePR and GetPRThatCausedCommit", func() {
+		It("returns an error when no PR caused the commit", func() {
+			_, err := provider.GetPRThatCausedCommit(ctx, fmt.Sprintf("%040d", 42))
+			Expect(err.Error()).To(ContainSubstring("no PR found for sha:"))
+		})
+
+		It("finds the merged PR from the merge commit", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(provider.MergePR(ctx, id, standIn.prs[0].FromRef.LatestCommit)).To(Succeed())
+			pr, err := provider.GetPRThatCausedCommit(ctx, standIn.prs[0].Properties.MergeCommit.ID)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+
+		It("does not merge a PR whose head has moved", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			err = provider.MergePR(ctx, id, fmt.Sprintf("%040d", 42))
+			Expect(err).To(MatchError(ContainSubstring("expected")))
+			Expect(standIn.prs[0].State).To(Equal(bitbucketStateOpen))
+		})
+	})
+})
@@ -0,0 +1,291 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	git2go "github.com/libgit2/git2go/v33"
+)
+
+// fakeStateFileName is the name of the file in the bare remote repository where the fake
+// provider keeps its state. Git ignores unknown files in the repository directory.
+const fakeStateFileName = "gitops-promotion-fake.json"
+
+// fakeMutex serializes access to the state files of all fake providers in the process.
+var fakeMutex sync.Mutex
+
+// FakeGITProvider is a provider for a bare repository on the local file system. Pull requests
+// and statuses are stored in a JSON file next to the repository data and pull requests are
+// merged directly in the bare repository. It is meant for testing without a real provider.
+type FakeGITProvider struct {
+	path string
+}
+
+type fakeState struct {
+	PullRequests []*fakePullRequest       `json:"pullRequests"`
+	Statuses     map[string][]*fakeStatus `json:"statuses"`
+}
+
+type fakePullRequest struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Auto        bool   `json:"auto"`
+	Merged      bool   `json:"merged"`
+	MergeCommit string `json:"mergeCommit,omitempty"`
+}
+
+type fakeStatus struct {
+	Context   string `json:"context"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+// NewFakeGITProvider ...
+func NewFakeGITProvider(ctx context.Context, remoteURL, token string) (*FakeGITProvider, error) {
+	if remoteURL == "" {
+		return nil, fmt.Errorf("remoteURL empty")
+	}
+
+	path := strings.TrimPrefix(remoteURL, "file://")
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("remote is not a local path: %s", remoteURL)
+	}
+	repo, err := git2go.OpenRepository(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open remote repository: %w", err)
+	}
+	defer repo.Free()
+	if !repo.IsBare() {
+		return nil, fmt.Errorf("remote repository is not bare: %s", path)
+	}
+
+	return &FakeGITProvider{
+		path: path,
+	}, nil
+}
+
+// CreatePR ...
+func (g *FakeGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
+	var pr *fakePullRequest
+	err := g.update(func(state *fakeState) error {
+		for _, p := range state.PullRequests {
+			if !p.Merged && p.Source == branchName && p.Target == targetBranch {
+				pr = p
+			}
+		}
+		if pr == nil {
+			pr = &fakePullRequest{
+				ID:     len(state.PullRequests) + 1,
+				Source: branchName,
+				Target: targetBranch,
+			}
+			state.PullRequests = append(state.PullRequests, pr)
+			log.Printf("Created new PR #%d merging %s -> %s\n", pr.ID, pr.Source, pr.Target)
+		} else {
+			log.Printf("Updated PR #%d merging %s -> %s\n", pr.ID, pr.Source, pr.Target)
+		}
+		pr.Title = title
+		pr.Description = description
+		pr.Auto = auto
+
+		// There are no required checks in the fake provider, so auto-merge happens right away.
+		if auto {
+			return g.merge(pr, "")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pr.ID, nil
+}
+
+func (g *FakeGITProvider) GetStatus(ctx context.Context, sha string, group string, env string) (CommitStatus, error) {
+	state, err := g.load()
+	if err != nil {
+		return CommitStatus{}, err
+	}
+
+	// Statuses are stored with the newest first, like most providers return them.
+	name := fmt.Sprintf("%s-%s", group, env)
+	for _, s := range state.Statuses[sha] {
+		comp := strings.Split(s.Context, "/")
+		if len(comp) < 2 {
+			return CommitStatus{}, fmt.Errorf("status context in wrong format: %q", s.Context)
+		}
+		if comp[1] == name {
+			return CommitStatus{
+				Succeeded: s.Succeeded,
+			}, nil
+		}
+	}
+	return CommitStatus{}, fmt.Errorf("no status found for sha %q", sha)
+}
+
+func (g *FakeGITProvider) SetStatus(ctx context.Context, sha string, group string, env string, succeeded bool) error {
+	return g.update(func(state *fakeState) error {
+		status := &fakeStatus{
+			Context:   fmt.Sprintf("kind/%s-%s", group, env),
+			Succeeded: succeeded,
+		}
+		state.Statuses[sha] = append([]*fakeStatus{status}, state.Statuses[sha]...)
+		return nil
+	})
+}
+
+func (g *FakeGITProvider) MergePR(ctx context.Context, id int, sha string) error {
+	return g.update(func(state *fakeState) error {
+		for _, pr := range state.PullRequests {
+			if pr.ID != id {
+				continue
+			}
+			if pr.Merged {
+				return fmt.Errorf("PR with ID %d is already merged", id)
+			}
+			return g.merge(pr, sha)
+		}
+		return fmt.Errorf("no PR found with ID %d", id)
+	})
+}
+
+func (g *FakeGITProvider) GetPRWithBranch(ctx context.Context, source, target string) (PullRequest, error) {
+	state, err := g.load()
+	if err != nil {
+		return PullRequest{}, err
+	}
+	for _, pr := range state.PullRequests {
+		if !pr.Merged && pr.Source == source && pr.Target == target {
+			return NewPullRequest(&pr.ID, &pr.Title, &pr.Description)
+		}
+	}
+	return PullRequest{}, fmt.Errorf("no PR found for branches %q-%q", source, target)
+}
+
+func (g *FakeGITProvider) GetPRThatCausedCommit(ctx context.Context, sha string) (PullRequest, error) {
+	state, err := g.load()
+	if err != nil {
+		return PullRequest{}, err
+	}
+	for _, pr := range state.PullRequests {
+		if pr.Merged && pr.MergeCommit == sha {
+			return NewPullRequest(&pr.ID, &pr.Title, &pr.Description)
+		}
+	}
+	return PullRequest{}, fmt.Errorf("no PR found for sha: %s", sha)
+}
+
+// merge creates a merge commit of the source branch into the target branch in the bare
+// repository. The merge is refused if sha is set and is not the head of the source branch.
+func (g *FakeGITProvider) merge(pr *fakePullRequest, sha string) error {
+	repo, err := git2go.OpenRepository(g.path)
+	if err != nil {
+		return err
+	}
+	defer repo.Free()
+
+	source, err := repo.LookupBranch(pr.Source, git2go.BranchLocal)
+	if err != nil {
+		return fmt.Errorf("could not find source branch %q: %w", pr.Source, err)
+	}
+	if sha != "" && source.Target().String() != sha {
+		return fmt.Errorf("PR with ID %d has head %s, expected %s", pr.ID, source.Target(), sha)
+	}
+	target, err := repo.LookupBranch(pr.Target, git2go.BranchLocal)
+	if err != nil {
+		return fmt.Errorf("could not find target branch %q: %w", pr.Target, err)
+	}
+	sourceCommit, err := repo.LookupCommit(source.Target())
+	if err != nil {
+		return err
+	}
+	targetCommit, err := repo.LookupCommit(target.Target())
+	if err != nil {
+		return err
+	}
+
+	idx, err := repo.MergeCommits(targetCommit, sourceCommit, nil)
+	if err != nil {
+		return err
+	}
+	defer idx.Free()
+	if idx.HasConflicts() {
+		return fmt.Errorf("PR with ID %d has merge conflicts", pr.ID)
+	}
+	treeID, err := idx.WriteTreeTo(repo)
+	if err != nil {
+		return err
+	}
+	tree, err := repo.LookupTree(treeID)
+	if err != nil {
+		return err
+	}
+
+	signature := &git2go.Signature{
+		Name:  "gitops-promotion",
+		Email: "gitops-promotion@xenit.se",
+		When:  time.Now(),
+	}
+	message := fmt.Sprintf("Merge pull request #%d from %s\n\n%s", pr.ID, pr.Source, pr.Title)
+	mergeID, err := repo.CreateCommit(fmt.Sprintf("refs/heads/%s", pr.Target), signature, signature, message, tree, targetCommit, sourceCommit)
+	if err != nil {
+		return err
+	}
+
+	pr.Merged = true
+	pr.MergeCommit = mergeID.String()
+	log.Printf("Merged PR #%d as %s\n", pr.ID, pr.MergeCommit)
+	return nil
+}
+
+func (g *FakeGITProvider) load() (*fakeState, error) {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	return g.read()
+}
+
+// update applies fn to the state and writes it back if fn does not return an error.
+func (g *FakeGITProvider) update(fn func(state *fakeState) error) error {
+	fakeMutex.Lock()
+	defer fakeMutex.Unlock()
+	state, err := g.read()
+	if err != nil {
+		return err
+	}
+	err = fn(state)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.path, fakeStateFileName), b, 0600)
+}
+
+func (g *FakeGITProvider) read() (*fakeState, error) {
+	state := &fakeState{}
+	b, err := os.ReadFile(filepath.Join(g.path, fakeStateFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(b, state)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse fake provider state: %w", err)
+		}
+	}
+	if state.Statuses == nil {
+		state.Statuses = map[string][]*fakeStatus{}
+	}
+	return state, nil
+}
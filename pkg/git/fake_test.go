@@ -0,0 +1,169 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	git2go "github.com/libgit2/git2go/v33"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeCommitFile commits a single file directly to ref in a bare repository.
+func fakeCommitFile(repo *git2go.Repository, ref string, parent *git2go.Commit, name, content string) *git2go.Commit {
+	blobID, err := repo.CreateBlobFromBuffer([]byte(content))
+	Expect(err).To(BeNil())
+	parents := []*git2go.Commit{}
+	builder, err := repo.TreeBuilder()
+	if parent != nil {
+		parents = append(parents, parent)
+		parentTree, e := parent.Tree()
+		Expect(e).To(BeNil())
+		builder, err = repo.TreeBuilderFromTree(parentTree)
+	}
+	Expect(err).To(BeNil())
+	Expect(builder.Insert(name, blobID, git2go.FilemodeBlob)).To(Succeed())
+	treeID, err := builder.Write()
+	Expect(err).To(BeNil())
+	tree, err := repo.LookupTree(treeID)
+	Expect(err).To(BeNil())
+	signature := &git2go.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commitID, err := repo.CreateCommit(ref, signature, signature, "add "+name, tree, parents...)
+	Expect(err).To(BeNil())
+	commit, err := repo.LookupCommit(commitID)
+	Expect(err).To(BeNil())
+	return commit
+}
+
+var _ = Describe("NewFakeGITProvider", func() {
+	var err error
+	var ctx context.Context
+
+	BeforeEach(func() {
+		err = nil
+		ctx = context.Background()
+	})
+
+	It("returns error when creating without url", func() {
+		_, err = NewFakeGITProvider(ctx, "", "")
+		Expect(err).To(MatchError("remoteURL empty"))
+	})
+
+	It("returns error when the remote is not bare", func() {
+		dir, e := os.MkdirTemp("", "gitops-promotion-fake")
+		Expect(e).To(BeNil())
+		defer os.RemoveAll(dir)
+		_, e = git2go.InitRepository(dir, false)
+		Expect(e).To(BeNil())
+		_, err = NewFakeGITProvider(ctx, "file://"+dir, "")
+		Expect(err).To(MatchError(fmt.Sprintf("remote repository is not bare: %s", dir)))
+	})
+})
+
+var _ = Describe("FakeGITProvider", func() {
+	var ctx context.Context
+	var dir string
+	var repo *git2go.Repository
+	var provider *FakeGITProvider
+	var head *git2go.Commit
+	branchName := "promote/testgroup-testapp"
+	state := &PRState{
+		Env:   "dev",
+		Group: "testgroup",
+		App:   "testapp",
+		Tag:   "v1.0.0",
+		Sha:   "",
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-fake")
+		Expect(err).To(BeNil())
+		repo, err = git2go.InitRepository(dir, true)
+		Expect(err).To(BeNil())
+		base := fakeCommitFile(repo, "refs/heads/"+DefaultBranch, nil, "README.md", "test")
+		head = fakeCommitFile(repo, "refs/heads/"+branchName, base, "app.yaml", "tag: v1.0.0")
+		provider, err = NewFakeGITProvider(ctx, dir, "")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		repo.Free()
+		os.RemoveAll(dir)
+	})
+
+	createPR := func(auto bool) (int, error) {
+		description, err := state.Description()
+		Expect(err).To(BeNil())
+		return provider.CreatePR(ctx, branchName, DefaultBranch, auto, state.Title(), description)
+	}
+
+	It("keeps its state in the remote repository", func() {
+		_, err := createPR(false)
+		Expect(err).To(BeNil())
+		Expect(filepath.Join(dir, fakeStateFileName)).To(BeARegularFile())
+	})
+
+	It("creates and updates a PR for the same branch", func() {
+		id, err := createPR(false)
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal(1))
+		id, err = createPR(false)
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal(1))
+		pr, err := provider.GetPRWithBranch(ctx, branchName, DefaultBranch)
+		Expect(err).To(BeNil())
+		Expect(pr.ID).To(Equal(1))
+		Expect(pr.State).To(Equal(state))
+	})
+
+	It("merges the PR into the default branch", func() {
+		id, err := createPR(false)
+		Expect(err).To(BeNil())
+		Expect(provider.MergePR(ctx, id, head.Id().String())).To(Succeed())
+
+		branch, err := repo.LookupBranch(DefaultBranch, git2go.BranchLocal)
+		Expect(err).To(BeNil())
+		merge, err := repo.LookupCommit(branch.Target())
+		Expect(err).To(BeNil())
+		Expect(merge.ParentCount()).To(Equal(uint(2)))
+		Expect(merge.ParentId(1).String()).To(Equal(head.Id().String()))
+
+		pr, err := provider.GetPRThatCausedCommit(ctx, merge.Id().String())
+		Expect(err).To(BeNil())
+		Expect(pr.ID).To(Equal(id))
+		_, err = provider.GetPRWithBranch(ctx, branchName, DefaultBranch)
+		Expect(err).To(MatchError(ContainSubstring("no PR found for branches")))
+	})
+
+	It("merges the PR right away when auto is true", func() {
+		_, err := createPR(true)
+		Expect(err).To(BeNil())
+		branch, err := repo.LookupBranch(DefaultBranch, git2go.BranchLocal)
+		Expect(err).To(BeNil())
+		_, err = provider.GetPRThatCausedCommit(ctx, branch.Target().String())
+		Expect(err).To(BeNil())
+	})
+
+	It("does not merge a PR whose head has moved", func() {
+		id, err := createPR(false)
+		Expect(err).To(BeNil())
+		err = provider.MergePR(ctx, id, fmt.Sprintf("%040d", 42))
+		Expect(err).To(MatchError(ContainSubstring("expected")))
+	})
+
+	It("reports the latest status", func() {
+		sha := head.Id().String()
+		_, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+		Expect(err).To(MatchError(fmt.Sprintf("no status found for sha %q", sha)))
+		Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+		Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, true)).To(Succeed())
+		status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+		Expect(err).To(BeNil())
+		Expect(status.Succeeded).To(BeTrue())
+	})
+})
@@ -4,18 +4,35 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	git2go "github.com/libgit2/git2go/v33"
+	"golang.org/x/oauth2"
 )
 
 const (
 	DefaultUsername = "git"
 	DefaultRemote   = "origin"
-	DefaultBranch   = "main"
+	// DefaultBranch is used when the default branch is neither configured nor can be detected.
+	DefaultBranch = "main"
 )
 
+// DefaultIdentity is the author and committer of commits when nothing else is configured.
+var DefaultIdentity = Identity{
+	Name:  "gitops-promotion",
+	Email: "gitops-promotion@xenit.se",
+}
+
+// Identity is the name and email of a commit author or committer.
+type Identity struct {
+	Name  string
+	Email string
+}
+
 type CommitStatus struct {
 	Succeeded bool
 }
@@ -24,47 +41,192 @@ type CommitStatus struct {
 type Repository struct {
 	gitRepository *git2go.Repository
 	gitProvider   GitProvider
-	token         string
+	username      string
+	tokenSource   oauth2.TokenSource
+	ssh           *sshAuth
+	signer        commitSigner
+	author        Identity
+	committer     Identity
+	remote        string
+	defaultBranch string
+}
+
+// RepositoryOptions configures how a local repository interacts with its remote.
+type RepositoryOptions struct {
+	Provider ProviderOptions
+	// SSH enables authentication with an SSH key for git operations against SSH remotes,
+	// while the provider API keeps using the token.
+	SSH *SSHOptions
+	// Signing enables signing of the commits that are created.
+	Signing *SigningOptions
+	// Author and Committer of the commits that are created. DefaultIdentity is used when
+	// the author is empty, and the author when the committer is empty.
+	Author    Identity
+	Committer Identity
+	// Remote is the name of the remote to fetch from, push to and derive the provider from.
+	// DefaultRemote is used when it is empty.
+	Remote string
+	// DefaultBranch is the branch that pull requests target. It is detected from the HEAD of
+	// the remote when empty.
+	DefaultBranch string
 }
 
 // LoadRepository loads a local git repository.
-func LoadRepository(ctx context.Context, path string, providerTypeString string, token string) (*Repository, error) {
+func LoadRepository(ctx context.Context, path string, providerTypeString string, token string, repoOpts RepositoryOptions) (*Repository, error) {
 	localRepo, err := git2go.OpenRepository(path)
 	if err != nil {
 		return &Repository{}, fmt.Errorf("could not open repository: %w", err)
 	}
-	remote, err := localRepo.Remotes.Lookup(DefaultRemote)
+	remoteName := repoOpts.Remote
+	if remoteName == "" {
+		remoteName = DefaultRemote
+	}
+	remote, err := localRepo.Remotes.Lookup(remoteName)
 	if err != nil {
-		return nil, fmt.Errorf("could not get remote: %w", err)
+		return nil, fmt.Errorf("could not get remote %q: %w", remoteName, err)
 	}
-	provider, err := NewGitProvider(ctx, ProviderType(providerTypeString), remote.Url(), token)
+
+	ssh, err := newSSHAuth(repoOpts.SSH)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newCommitSigner(repoOpts.Signing)
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub App installation tokens expire, so the same refreshing token source is used
+	// for both the provider and for git operations.
+	opts := repoOpts.Provider
+	username := DefaultUsername
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	if ProviderType(providerTypeString) == ProviderTypeGitHub && opts.GitHubApp != nil {
+		host, _, err := ParseGitAddress(remote.Url())
+		if err != nil {
+			return nil, err
+		}
+		apiURL, _ := gitHubAPIURLs(host, opts)
+		tokenSource, err = NewGitHubAppTokenSource(ctx, apiURL, *opts.GitHubApp)
+		if err != nil {
+			return nil, fmt.Errorf("could not create GitHub App token source: %w", err)
+		}
+		username = GitHubAppUsername
+		opts.tokenSource = tokenSource
+	}
+
+	provider, err := NewGitProvider(ctx, ProviderType(providerTypeString), remote.Url(), token, opts)
 	if err != nil {
 		return nil, fmt.Errorf("could not create git provider: %w", err)
 	}
-	return &Repository{
+	author := repoOpts.Author
+	if author == (Identity{}) {
+		author = DefaultIdentity
+	}
+	committer := repoOpts.Committer
+	if committer == (Identity{}) {
+		committer = author
+	}
+	repo := &Repository{
 		gitRepository: localRepo,
 		gitProvider:   provider,
-		token:         token,
-	}, nil
+		username:      username,
+		tokenSource:   tokenSource,
+		ssh:           ssh,
+		signer:        signer,
+		author:        author,
+		committer:     committer,
+		remote:        remoteName,
+		defaultBranch: repoOpts.DefaultBranch,
+	}
+	if repo.defaultBranch == "" {
+		repo.defaultBranch, err = repo.detectDefaultBranch(remote)
+		if err != nil {
+			log.Printf("Could not detect default branch, using %q: %v\n", DefaultBranch, err)
+			repo.defaultBranch = DefaultBranch
+		}
+	}
+	return repo, nil
+}
+
+// detectDefaultBranch returns the branch that HEAD of the remote points to. The remote-tracking
+// HEAD is used if it exists, which is the case for clones, otherwise the remote is asked.
+func (g *Repository) detectDefaultBranch(remote *git2go.Remote) (string, error) {
+	prefix := fmt.Sprintf("refs/remotes/%s/", g.remote)
+	ref, err := g.gitRepository.References.Lookup(prefix + "HEAD")
+	if err == nil && ref.Type() == git2go.ReferenceSymbolic {
+		return strings.TrimPrefix(ref.SymbolicTarget(), prefix), nil
+	}
+
+	callbacks, err := g.remoteCallbacks(remote.Url())
+	if err != nil {
+		return "", err
+	}
+	err = remote.ConnectFetch(&callbacks, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to remote: %w", err)
+	}
+	defer remote.Disconnect()
+	heads, err := remote.Ls()
+	if err != nil {
+		return "", fmt.Errorf("could not list remote references: %w", err)
+	}
+
+	// The remote only advertises the commit of HEAD, so look for branches pointing to the same commit.
+	var head *git2go.Oid
+	for _, h := range heads {
+		if h.Name == "HEAD" {
+			head = h.Id
+		}
+	}
+	if head == nil {
+		return "", fmt.Errorf("remote %q has no HEAD", g.remote)
+	}
+	candidates := []string{}
+	for _, h := range heads {
+		if strings.HasPrefix(h.Name, "refs/heads/") && h.Id.Equal(head) {
+			candidates = append(candidates, strings.TrimPrefix(h.Name, "refs/heads/"))
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no branch found for HEAD of remote %q", g.remote)
+	}
+	for _, preferred := range []string{DefaultBranch, "master"} {
+		for _, candidate := range candidates {
+			if candidate == preferred {
+				return candidate, nil
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates[0], nil
 }
 
-// FetchDefaultBranch updates DefaultBranch with new commits from DefaultRemote.
+// GetDefaultBranch returns the name of the branch that pull requests target.
+func (g *Repository) GetDefaultBranch() string {
+	return g.defaultBranch
+}
+
+// FetchBranch updates the branch with new commits from the remote and returns its latest commit.
 func (g *Repository) FetchBranch(branchName string) (*git2go.Oid, error) {
-	remote, err := g.gitRepository.Remotes.Lookup(DefaultRemote)
+	remote, err := g.gitRepository.Remotes.Lookup(g.remote)
+	if err != nil {
+		return nil, fmt.Errorf("could not find remote %q: %w", g.remote, err)
+	}
+	callbacks, err := g.remoteCallbacks(remote.Url())
 	if err != nil {
-		return nil, fmt.Errorf("could not find remote %q: %w", DefaultRemote, err)
+		return nil, err
 	}
 	err = remote.Fetch(
 		[]string{branchName},
 		&git2go.FetchOptions{
-			RemoteCallbacks: credentialsCallback(DefaultUsername, g.token),
+			RemoteCallbacks: callbacks,
 		},
 		"",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch: %w", err)
 	}
-	sha, err := g.GetLastCommitForBranch(fmt.Sprintf("%s/%s", DefaultRemote, DefaultBranch))
+	sha, err := g.GetLastCommitForBranch(fmt.Sprintf("%s/%s", g.remote, branchName))
 	if err != nil {
 		return nil, fmt.Errorf("fetch failed to lookup head sha: %w", err)
 	}
@@ -102,6 +264,19 @@ func (g *Repository) CreateBranch(branchName string, force bool) error {
 	return nil
 }
 
+// ResetToHead discards all changes to tracked files in the working tree and index.
+func (g *Repository) ResetToHead() error {
+	head, err := g.gitRepository.Head()
+	if err != nil {
+		return err
+	}
+	headCommit, err := g.gitRepository.LookupCommit(head.Target())
+	if err != nil {
+		return err
+	}
+	return g.gitRepository.ResetToCommit(headCommit, git2go.ResetHard, &git2go.CheckoutOptions{Strategy: git2go.CheckoutForce})
+}
+
 // GetLastCommitForBranch returns the latest commit id for the branch.
 func (g *Repository) GetLastCommitForBranch(branchName string) (*git2go.Oid, error) {
 	branch, err := g.gitRepository.LookupBranch(branchName, git2go.BranchRemote)
@@ -122,11 +297,16 @@ func (g *Repository) GetCurrentCommit() (*git2go.Oid, error) {
 
 // CreateCommit creates a commit in the specfied branch with the current changes.
 func (g *Repository) CreateCommit(branchName, message string) (*git2go.Oid, error) {
-	// TODO change to some bot name, probably break out in to config
-	signature := &git2go.Signature{
-		Name:  "gitops-promotion",
-		Email: "gitops-promotion@xenit.se",
-		When:  time.Now(),
+	now := time.Now()
+	author := &git2go.Signature{
+		Name:  g.author.Name,
+		Email: g.author.Email,
+		When:  now,
+	}
+	committer := &git2go.Signature{
+		Name:  g.committer.Name,
+		Email: g.committer.Email,
+		When:  now,
 	}
 	idx, err := g.gitRepository.Index()
 	if err != nil {
@@ -157,7 +337,15 @@ func (g *Repository) CreateCommit(branchName, message string) (*git2go.Oid, erro
 		return nil, err
 	}
 	refName := fmt.Sprintf("refs/heads/%s", branchName)
-	sha, err := g.gitRepository.CreateCommit(refName, signature, signature, message, tree, commitTarget)
+	if g.signer != nil {
+		sha, err := g.createSignedCommit(branch, author, committer, message, tree, commitTarget)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Created signed commit %s on %s with message '%s'\n", sha, refName, message)
+		return sha, nil
+	}
+	sha, err := g.gitRepository.CreateCommit(refName, author, committer, message, tree, commitTarget)
 	if err != nil {
 		return nil, err
 	}
@@ -165,6 +353,58 @@ func (g *Repository) CreateCommit(branchName, message string) (*git2go.Oid, erro
 	return sha, nil
 }
 
+// createSignedCommit creates a signed commit and moves the branch to it.
+func (g *Repository) createSignedCommit(
+	branch *git2go.Branch,
+	author, committer *git2go.Signature,
+	message string,
+	tree *git2go.Tree,
+	parent *git2go.Commit,
+) (*git2go.Oid, error) {
+	content, err := g.gitRepository.CreateCommitBuffer(author, committer, git2go.MessageEncodingUTF8, message, tree, parent)
+	if err != nil {
+		return nil, err
+	}
+	commitSignature, err := g.signer.sign(content)
+	if err != nil {
+		return nil, err
+	}
+	sha, err := g.gitRepository.CreateCommitWithSignature(string(content), commitSignature, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not create signed commit: %w", err)
+	}
+	_, err = branch.SetTarget(sha, "commit: "+message)
+	if err != nil {
+		return nil, err
+	}
+	return sha, nil
+}
+
+// ReadFile returns the content of the file at path in the commit. The returned error wraps
+// os.ErrNotExist if the file does not exist in the commit.
+func (g *Repository) ReadFile(sha *git2go.Oid, path string) ([]byte, error) {
+	commit, err := g.gitRepository.LookupCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := tree.EntryByPath(path)
+	if git2go.IsErrorCode(err, git2go.ErrorCodeNotFound) {
+		return nil, fmt.Errorf("could not find %s in %s: %w", path, sha, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob, err := g.gitRepository.LookupBlob(entry.Id)
+	if err != nil {
+		return nil, err
+	}
+	return blob.Contents(), nil
+}
+
 // GetLastCommitForPath returns the last commit for the given path. All files and subdirectories
 // will be considered if the path is a directory.
 //
@@ -239,9 +479,9 @@ func (g *Repository) GetLastCommitForPath(path string) (*git2go.Commit, error) {
 
 // Push pushes the given branch to the remote.
 func (g *Repository) Push(branchName string, force bool) error {
-	remote, err := g.gitRepository.Remotes.Lookup(DefaultRemote)
+	remote, err := g.gitRepository.Remotes.Lookup(g.remote)
 	if err != nil {
-		return fmt.Errorf("could not find remote %q: %w", DefaultRemote, err)
+		return fmt.Errorf("could not find remote %q: %w", g.remote, err)
 	}
 
 	forceFlag := "+"
@@ -249,8 +489,12 @@ func (g *Repository) Push(branchName string, force bool) error {
 		forceFlag = ""
 	}
 
+	callbacks, err := g.remoteCallbacks(remote.Url())
+	if err != nil {
+		return err
+	}
 	branches := []string{fmt.Sprintf("%srefs/heads/%s", forceFlag, branchName)}
-	err = remote.Push(branches, &git2go.PushOptions{RemoteCallbacks: credentialsCallback(DefaultUsername, g.token)})
+	err = remote.Push(branches, &git2go.PushOptions{RemoteCallbacks: callbacks})
 	if err != nil {
 		return fmt.Errorf("failed pushing branches %s: %w", branches, err)
 	}
@@ -258,9 +502,9 @@ func (g *Repository) Push(branchName string, force bool) error {
 	return nil
 }
 
-// CreatePR creates a PR for the branch. It assumes that the branch has been pushed.
+// CreatePR creates a PR for the branch against the default branch. It assumes that the branch has been pushed.
 func (g *Repository) CreatePR(ctx context.Context, branchName string, auto bool, title, description string) (int, error) {
-	return g.gitProvider.CreatePR(ctx, branchName, auto, title, description)
+	return g.gitProvider.CreatePR(ctx, branchName, g.defaultBranch, auto, title, description)
 }
 
 // GetStatus returns the status for the give commit.
@@ -292,7 +536,7 @@ func (g *Repository) GetPRForCurrentBranch(ctx context.Context) (PullRequest, er
 	if err != nil {
 		return PullRequest{}, err
 	}
-	pr, err := g.gitProvider.GetPRWithBranch(ctx, branchName, DefaultBranch)
+	pr, err := g.gitProvider.GetPRWithBranch(ctx, branchName, g.defaultBranch)
 	if err != nil {
 		return PullRequest{}, err
 	}
@@ -312,20 +556,48 @@ func (g *Repository) GetPRThatCausedCurrentCommit(ctx context.Context) (PullRequ
 	return pr, err
 }
 
-func Clone(url, username, password, path, branchName string) error {
-	_, err := git2go.Clone(url, path, &git2go.CloneOptions{
+// Clone clones the branch of the remote repository to path. The SSH options are only
+// used for SSH remotes and may be nil.
+func Clone(url, username, password, path, branchName string, sshOpts *SSHOptions) error {
+	ssh, err := newSSHAuth(sshOpts)
+	if err != nil {
+		return err
+	}
+	_, err = git2go.Clone(url, path, &git2go.CloneOptions{
 		FetchOptions: git2go.FetchOptions{
 			DownloadTags:    git2go.DownloadTagsNone,
-			RemoteCallbacks: credentialsCallback(username, password),
+			RemoteCallbacks: credentialsCallback(url, username, password, ssh),
+		},
+		// The zero value of the checkout strategy is a dry run, which leaves the working tree empty.
+		CheckoutOptions: git2go.CheckoutOptions{
+			Strategy: git2go.CheckoutSafe,
 		},
 		CheckoutBranch: branchName,
 	})
 	return err
 }
 
-func credentialsCallback(username, password string) git2go.RemoteCallbacks {
-	return git2go.RemoteCallbacks{
+// remoteCallbacks returns callbacks authenticating with the current token, which
+// may have been refreshed since the last git operation.
+func (g *Repository) remoteCallbacks(remoteURL string) (git2go.RemoteCallbacks, error) {
+	token, err := g.tokenSource.Token()
+	if err != nil {
+		return git2go.RemoteCallbacks{}, fmt.Errorf("could not get token: %w", err)
+	}
+	return credentialsCallback(remoteURL, g.username, token.AccessToken, g.ssh), nil
+}
+
+// credentialsCallback authenticates with the SSH key when the remote allows it and one is
+// configured, and with the username and password otherwise.
+func credentialsCallback(remoteURL, username, password string, ssh *sshAuth) git2go.RemoteCallbacks {
+	callbacks := git2go.RemoteCallbacks{
 		CredentialsCallback: func(url string, usernameFromURL string, allowedTypes git2go.CredentialType) (*git2go.Credential, error) {
+			if ssh != nil && allowedTypes&git2go.CredentialTypeSSHCustom != 0 {
+				if usernameFromURL == "" {
+					usernameFromURL = DefaultUsername
+				}
+				return git2go.NewCredentialSSHKeyFromSigner(usernameFromURL, ssh.signer)
+			}
 			cred, err := git2go.NewCredentialUserpassPlaintext(username, password)
 			if err != nil {
 				return nil, err
@@ -333,4 +605,8 @@ func credentialsCallback(username, password string) git2go.RemoteCallbacks {
 			return cred, nil
 		},
 	}
+	if ssh != nil {
+		callbacks.CertificateCheckCallback = ssh.certificateCheck(remoteURL)
+	}
+	return callbacks
 }
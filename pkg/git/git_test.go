@@ -0,0 +1,216 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	git2go "github.com/libgit2/git2go/v33"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// createLocalTestRepository creates a repository with a single commit on the default branch in dir,
+// with an empty bare repository as remote. It returns the path to the repository.
+func createLocalTestRepository(dir string) string {
+	remotePath := filepath.Join(dir, "remote.git")
+	remote, err := git2go.InitRepository(remotePath, true)
+	Expect(err).To(BeNil())
+	remote.Free()
+
+	localPath := filepath.Join(dir, "local")
+	local, err := git2go.InitRepository(localPath, false)
+	Expect(err).To(BeNil())
+	defer local.Free()
+	fakeCommitFile(local, "refs/heads/"+DefaultBranch, nil, "README.md", "test")
+	Expect(local.SetHead("refs/heads/" + DefaultBranch)).To(Succeed())
+	Expect(local.CheckoutHead(&git2go.CheckoutOptions{Strategy: git2go.CheckoutForce})).To(Succeed())
+	_, err = local.Remotes.Create(DefaultRemote, remotePath)
+	Expect(err).To(BeNil())
+	return localPath
+}
+
+var _ = Describe("CreateCommit", func() {
+	var ctx context.Context
+	var dir string
+	var localPath string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-commit")
+		Expect(err).To(BeNil())
+		localPath = createLocalTestRepository(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// commitAs creates a commit with the given options and returns it.
+	commitAs := func(opts RepositoryOptions) *git2go.Commit {
+		repo, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", opts)
+		Expect(err).To(BeNil())
+		Expect(repo.CreateBranch("promote/test", false)).To(Succeed())
+		sha, err := repo.CreateCommit("promote/test", "chore: promote")
+		Expect(err).To(BeNil())
+		commit, err := repo.gitRepository.LookupCommit(sha)
+		Expect(err).To(BeNil())
+		Expect(commit.Message()).To(Equal("chore: promote"))
+		return commit
+	}
+
+	It("uses the default identity", func() {
+		commit := commitAs(RepositoryOptions{})
+		Expect(commit.Author().Name).To(Equal(DefaultIdentity.Name))
+		Expect(commit.Author().Email).To(Equal(DefaultIdentity.Email))
+		Expect(commit.Committer().Email).To(Equal(DefaultIdentity.Email))
+	})
+
+	It("uses the author as committer", func() {
+		commit := commitAs(RepositoryOptions{Author: Identity{Name: "Bot", Email: "bot@example.com"}})
+		Expect(commit.Author().Email).To(Equal("bot@example.com"))
+		Expect(commit.Committer().Name).To(Equal("Bot"))
+		Expect(commit.Committer().Email).To(Equal("bot@example.com"))
+	})
+
+	It("uses the configured author and committer", func() {
+		commit := commitAs(RepositoryOptions{
+			Author:    Identity{Name: "Bot", Email: "bot@example.com"},
+			Committer: Identity{Name: "CI", Email: "ci@example.com"},
+		})
+		Expect(commit.Author().Name).To(Equal("Bot"))
+		Expect(commit.Committer().Name).To(Equal("CI"))
+		Expect(commit.Committer().Email).To(Equal("ci@example.com"))
+	})
+})
+
+var _ = Describe("GetDefaultBranch", func() {
+	var ctx context.Context
+	var dir string
+	var localPath string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-default-branch")
+		Expect(err).To(BeNil())
+		localPath = createLocalTestRepository(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// setRemoteHead commits to branch in the remote repository and points HEAD of the remote to it.
+	setRemoteHead := func(branch string) {
+		remote, err := git2go.OpenRepository(filepath.Join(dir, "remote.git"))
+		Expect(err).To(BeNil())
+		defer remote.Free()
+		commit := fakeCommitFile(remote, "refs/heads/"+branch, nil, "README.md", "test")
+		fakeCommitFile(remote, "refs/heads/other", commit, "other.txt", "test")
+		Expect(remote.SetHead("refs/heads/" + branch)).To(Succeed())
+	}
+
+	loadDefaultBranch := func(opts RepositoryOptions) string {
+		repo, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", opts)
+		Expect(err).To(BeNil())
+		return repo.GetDefaultBranch()
+	}
+
+	It("uses the configured default branch", func() {
+		setRemoteHead("master")
+		Expect(loadDefaultBranch(RepositoryOptions{DefaultBranch: "develop"})).To(Equal("develop"))
+	})
+
+	It("detects the default branch from the remote-tracking HEAD", func() {
+		repo, err := git2go.OpenRepository(localPath)
+		Expect(err).To(BeNil())
+		defer repo.Free()
+		_, err = repo.References.CreateSymbolic("refs/remotes/origin/HEAD", "refs/remotes/origin/trunk", true, "")
+		Expect(err).To(BeNil())
+		Expect(loadDefaultBranch(RepositoryOptions{})).To(Equal("trunk"))
+	})
+
+	It("detects the default branch from the remote", func() {
+		setRemoteHead("master")
+		Expect(loadDefaultBranch(RepositoryOptions{})).To(Equal("master"))
+	})
+
+	It("falls back to the default when the remote has no HEAD", func() {
+		Expect(loadDefaultBranch(RepositoryOptions{})).To(Equal(DefaultBranch))
+	})
+
+	It("uses the configured remote", func() {
+		setRemoteHead("master")
+		repo, err := git2go.OpenRepository(localPath)
+		Expect(err).To(BeNil())
+		defer repo.Free()
+		Expect(repo.Remotes.Rename(DefaultRemote, "upstream")).To(BeEmpty())
+
+		_, err = LoadRepository(ctx, localPath, string(ProviderTypeFake), "", RepositoryOptions{})
+		Expect(err).To(MatchError(ContainSubstring(`could not get remote "origin"`)))
+		Expect(loadDefaultBranch(RepositoryOptions{Remote: "upstream"})).To(Equal("master"))
+
+		loaded, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", RepositoryOptions{Remote: "upstream"})
+		Expect(err).To(BeNil())
+		sha, err := loaded.FetchBranch("master")
+		Expect(err).To(BeNil())
+		Expect(sha).ToNot(BeNil())
+	})
+})
+
+var _ = Describe("ResetToHead", func() {
+	var dir string
+	var localPath string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-reset")
+		Expect(err).To(BeNil())
+		localPath = createLocalTestRepository(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("discards changes to tracked files", func() {
+		repo, err := LoadRepository(context.Background(), localPath, string(ProviderTypeFake), "", RepositoryOptions{})
+		Expect(err).To(BeNil())
+		Expect(os.WriteFile(filepath.Join(localPath, "README.md"), []byte("changed"), 0600)).To(Succeed())
+		Expect(repo.ResetToHead()).To(Succeed())
+		b, err := os.ReadFile(filepath.Join(localPath, "README.md"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("test"))
+	})
+})
+
+var _ = Describe("ReadFile", func() {
+	var dir string
+	var localPath string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-read")
+		Expect(err).To(BeNil())
+		localPath = createLocalTestRepository(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads files from a commit", func() {
+		repo, err := LoadRepository(context.Background(), localPath, string(ProviderTypeFake), "", RepositoryOptions{})
+		Expect(err).To(BeNil())
+		sha, err := repo.GetCurrentCommit()
+		Expect(err).To(BeNil())
+		b, err := repo.ReadFile(sha, "README.md")
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("test"))
+		_, err = repo.ReadFile(sha, "missing.yaml")
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+})
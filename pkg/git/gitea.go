@@ -0,0 +1,290 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/avast/retry-go"
+)
+
+// GiteaGITProvider ...
+type GiteaGITProvider struct {
+	client *gitea.Client
+	owner  string
+	repo   string
+}
+
+// NewGiteaGITProvider ...
+func NewGiteaGITProvider(ctx context.Context, remoteURL, token string) (*GiteaGITProvider, error) {
+	if remoteURL == "" {
+		return nil, fmt.Errorf("remoteURL empty")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token empty")
+	}
+
+	host, id, err := ParseGitAddress(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := strings.Split(id, "/")
+	if len(comp) != 2 {
+		return nil, fmt.Errorf("invalid repository id %q", id)
+	}
+	owner := comp[0]
+	repo := comp[1]
+
+	client, err := gitea.NewClient(host, gitea.SetToken(token), gitea.SetContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GiteaGITProvider{
+		client: client,
+		owner:  owner,
+		repo:   repo,
+	}, nil
+}
+
+// CreatePR ...
+func (g *GiteaGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
+	g.client.SetContext(ctx)
+	sourceName := branchName
+	targetName := targetBranch
+
+	prsOnBranch, err := g.listPRs(gitea.StateOpen, func(pr *gitea.PullRequest) bool {
+		return pr.Head != nil && pr.Base != nil && pr.Head.Ref == sourceName && pr.Base.Ref == targetName
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var pr *gitea.PullRequest
+	switch len(prsOnBranch) {
+	case 0:
+		createOpts := gitea.CreatePullRequestOption{
+			Title: title,
+			Body:  description,
+			Head:  sourceName,
+			Base:  targetName,
+		}
+		pr, _, err = g.client.CreatePullRequest(g.owner, g.repo, createOpts)
+		if err == nil {
+			log.Printf("Created new PR #%d merging %s -> %s\n", pr.Index, sourceName, targetName)
+		}
+	case 1:
+		editOpts := gitea.EditPullRequestOption{
+			Title: title,
+			Body:  description,
+		}
+		pr, _, err = g.client.EditPullRequest(g.owner, g.repo, prsOnBranch[0].Index, editOpts)
+		if err == nil {
+			log.Printf("Updated PR #%d merging %s -> %s\n", pr.Index, sourceName, targetName)
+		}
+	default:
+		return 0, fmt.Errorf("received more than one PRs when listing: %d", len(prsOnBranch))
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if auto {
+		// Gitea will merge the PR directly if all checks have already passed,
+		// otherwise the merge is scheduled until the checks succeed.
+		mergeOpts := gitea.MergePullRequestOption{
+			Style:                  gitea.MergeStyleMerge,
+			DeleteBranchAfterMerge: true,
+			MergeWhenChecksSucceed: true,
+		}
+		_, res, err := g.client.MergePullRequest(g.owner, g.repo, pr.Index, mergeOpts)
+		switch {
+		case err != nil:
+			log.Printf("Failed to activate auto-merge for PR #%d: %v", pr.Index, err)
+			return 0, fmt.Errorf("could not set auto-merge on PR #%d: %w", pr.Index, err)
+		case res.StatusCode == http.StatusConflict:
+			log.Printf("Auto-merge already scheduled for PR #%d\n", pr.Index)
+		case res.StatusCode >= http.StatusBadRequest:
+			return 0, fmt.Errorf("could not set auto-merge on PR #%d (check that Gitea is 1.17 or later): %s", pr.Index, res.Status)
+		default:
+			log.Printf("Auto-merge activated for PR #%d\n", pr.Index)
+		}
+	}
+	return int(pr.Index), nil
+}
+
+func (g *GiteaGITProvider) GetStatus(ctx context.Context, sha string, group string, env string) (CommitStatus, error) {
+	g.client.SetContext(ctx)
+	opts := gitea.ListStatusesOption{ListOptions: gitea.ListOptions{PageSize: 50}}
+	statuses, _, err := g.client.ListStatuses(g.owner, g.repo, sha, opts)
+	if err != nil {
+		return CommitStatus{}, err
+	}
+	var displays = make([]string, len(statuses))
+	for i := range statuses {
+		s := statuses[i]
+		displays = append(displays, fmt.Sprintf("%s: %s (%s)", s.Context, s.State, s.Description))
+	}
+	log.Printf("Considering statuses %v\n", displays)
+
+	// The Flux notification controller sets the context to <kind>/<name>, optionally
+	// followed by a provider specific suffix, and Gitea lists the newest status first.
+	name := fmt.Sprintf("%s-%s", group, env)
+	for _, s := range statuses {
+		comp := strings.Split(s.Context, "/")
+		if len(comp) < 2 {
+			return CommitStatus{}, fmt.Errorf("status context in wrong format: %q", s.Context)
+		}
+		if comp[1] == name {
+			return CommitStatus{
+				Succeeded: s.State == gitea.StatusSuccess,
+			}, nil
+		}
+	}
+	return CommitStatus{}, fmt.Errorf("no status found for sha %q", sha)
+}
+
+func (g *GiteaGITProvider) SetStatus(ctx context.Context, sha string, group string, env string, succeeded bool) error {
+	description := fmt.Sprintf("%s-%s-%s", group, env, sha)
+	name := fmt.Sprintf("kind/%s-%s", group, env)
+
+	state := gitea.StatusSuccess
+	if !succeeded {
+		state = gitea.StatusFailure
+	}
+
+	status := gitea.CreateStatusOption{
+		State:       state,
+		Context:     name,
+		Description: description,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	g.client.SetContext(ctx)
+
+	_, _, err := g.client.CreateStatus(g.owner, g.repo, sha, status)
+	return err
+}
+
+func (g *GiteaGITProvider) MergePR(ctx context.Context, id int, sha string) error {
+	g.client.SetContext(ctx)
+	opts := gitea.MergePullRequestOption{
+		Style:                  gitea.MergeStyleMerge,
+		HeadCommitId:           sha,
+		DeleteBranchAfterMerge: true,
+	}
+
+	var merged bool
+	var res *gitea.Response
+	err := retry.Do(
+		func() error {
+			var err error
+			merged, res, err = g.client.MergePullRequest(g.owner, g.repo, int64(id), opts)
+			if err != nil {
+				return err
+			}
+			// Gitea responds with 405 while the PR is still being checked for conflicts.
+			if res.StatusCode == http.StatusMethodNotAllowed {
+				return fmt.Errorf("PR with ID %d is not mergeable yet", id)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if !merged {
+		return fmt.Errorf("PR with ID %d was not merged: %s", id, res.Status)
+	}
+
+	return nil
+}
+
+func (g *GiteaGITProvider) GetPRWithBranch(ctx context.Context, source, target string) (PullRequest, error) {
+	g.client.SetContext(ctx)
+	var prs []*gitea.PullRequest
+	err := retry.Do(
+		func() error {
+			var err error
+			prs, err = g.listPRs(gitea.StateOpen, func(pr *gitea.PullRequest) bool {
+				return pr.Head != nil && pr.Base != nil && pr.Head.Ref == source && pr.Base.Ref == target
+			})
+			if err != nil {
+				return err
+			}
+			if len(prs) != 1 {
+				return fmt.Errorf("no PR found for branches %q-%q", source, target)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	return newGiteaPullRequest(prs[0])
+}
+
+func (g *GiteaGITProvider) GetPRThatCausedCommit(ctx context.Context, sha string) (PullRequest, error) {
+	g.client.SetContext(ctx)
+	var prs []*gitea.PullRequest
+	err := retry.Do(
+		func() error {
+			var err error
+			prs, err = g.listPRs(gitea.StateClosed, func(pr *gitea.PullRequest) bool {
+				// The SHA will be nil if the PR is closed without being merged
+				return pr.HasMerged && pr.MergedCommitID != nil && *pr.MergedCommitID == sha
+			})
+			if err != nil {
+				return err
+			}
+			if len(prs) != 1 {
+				return fmt.Errorf("no PR found for sha: %s", sha)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	return newGiteaPullRequest(prs[0])
+}
+
+func (g *GiteaGITProvider) listPRs(state gitea.StateType, match func(pr *gitea.PullRequest) bool) ([]*gitea.PullRequest, error) {
+	listOpts := gitea.ListPullRequestsOptions{
+		ListOptions: gitea.ListOptions{PageSize: 50},
+		State:       state,
+	}
+	prs, _, err := g.client.ListRepoPullRequests(g.owner, g.repo, listOpts)
+	if err != nil {
+		return nil, err
+	}
+	result := []*gitea.PullRequest{}
+	for _, pr := range prs {
+		if pr == nil || !match(pr) {
+			continue
+		}
+		result = append(result, pr)
+	}
+	return result, nil
+}
+
+func newGiteaPullRequest(pr *gitea.PullRequest) (PullRequest, error) {
+	id := int(pr.Index)
+	return NewPullRequest(&id, &pr.Title, &pr.Body)
+}
@@ -0,0 +1,288 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"code.gitea.io/sdk/gitea"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// giteaStandIn keeps the pull requests and commit statuses of owner/repo in memory and serves
+// them like the Gitea v1 API. Scheduled merges are recorded per pull request, and scheduling one
+// twice conflicts as it does on a real server.
+type giteaStandIn struct {
+	standInRouter
+	prs       []*gitea.PullRequest
+	statuses  map[string][]*gitea.Status
+	scheduled map[int64]bool
+}
+
+func newGiteaStandIn() *giteaStandIn {
+	s := &giteaStandIn{
+		statuses:  map[string][]*gitea.Status{},
+		scheduled: map[int64]bool{},
+	}
+	prefix := "/api/v1/repos/owner/repo"
+	s.handle(http.MethodGet, "/api/v1/version", s.version)
+	s.handle(http.MethodGet, prefix+"/pulls", s.listPullRequests)
+	s.handle(http.MethodPost, prefix+"/pulls", s.createPullRequest)
+	s.handle(http.MethodPatch, prefix+"/pulls/*", s.editPullRequest)
+	s.handle(http.MethodPost, prefix+"/pulls/*/merge", s.mergePullRequest)
+	s.handle(http.MethodGet, prefix+"/commits/*/statuses", s.listStatuses)
+	s.handle(http.MethodPost, prefix+"/statuses/*", s.createStatus)
+	return s
+}
+
+func (s *giteaStandIn) version(w http.ResponseWriter, _ *http.Request, _ []string) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": "1.17.3"})
+}
+
+func (s *giteaStandIn) listPullRequests(w http.ResponseWriter, r *http.Request, _ []string) {
+	result := []*gitea.PullRequest{}
+	for _, pr := range s.prs {
+		if string(pr.State) == r.URL.Query().Get("state") {
+			result = append(result, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *giteaStandIn) createPullRequest(w http.ResponseWriter, r *http.Request, _ []string) {
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	index := int64(len(s.prs) + 1)
+	pr := &gitea.PullRequest{
+		Index: index,
+		Title: fmt.Sprint(body["title"]),
+		Body:  fmt.Sprint(body["body"]),
+		State: gitea.StateOpen,
+		Head:  &gitea.PRBranchInfo{Ref: fmt.Sprint(body["head"]), Sha: fmt.Sprintf("%040d", index)},
+		Base:  &gitea.PRBranchInfo{Ref: fmt.Sprint(body["base"])},
+	}
+	s.prs = append(s.prs, pr)
+	writeJSON(w, http.StatusCreated, pr)
+}
+
+func (s *giteaStandIn) editPullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.prs))
+	if i < 0 {
+		return
+	}
+	pr := s.prs[i]
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	pr.Title = fmt.Sprint(body["title"])
+	pr.Body = fmt.Sprint(body["body"])
+	writeJSON(w, http.StatusCreated, pr)
+}
+
+func (s *giteaStandIn) mergePullRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.prs))
+	if i < 0 {
+		return
+	}
+	pr := s.prs[i]
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	if v, ok := body["merge_when_checks_succeed"]; ok && v == true {
+		if s.scheduled[pr.Index] {
+			writeJSON(w, http.StatusConflict, map[string]string{"message": "already scheduled"})
+			return
+		}
+		s.scheduled[pr.Index] = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if v, ok := body["head_commit_id"]; ok && v != "" && v != pr.Head.Sha {
+		writeJSON(w, http.StatusConflict, map[string]string{"message": "head out of date"})
+		return
+	}
+	mergeCommitID := fmt.Sprintf("%040d", 1000+pr.Index)
+	pr.State = gitea.StateClosed
+	pr.HasMerged = true
+	pr.MergedCommitID = &mergeCommitID
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *giteaStandIn) listStatuses(w http.ResponseWriter, _ *http.Request, params []string) {
+	statuses := s.statuses[params[0]]
+	if statuses == nil {
+		statuses = []*gitea.Status{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *giteaStandIn) createStatus(w http.ResponseWriter, r *http.Request, params []string) {
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	status := &gitea.Status{
+		Context:     fmt.Sprint(body["context"]),
+		State:       gitea.StatusState(fmt.Sprint(body["state"])),
+		Description: fmt.Sprint(body["description"]),
+	}
+	s.statuses[params[0]] = append([]*gitea.Status{status}, s.statuses[params[0]]...)
+	writeJSON(w, http.StatusCreated, status)
+}
+
+var _ = Describe("NewGiteaGITProvider", func() {
+	var err error
+	var ctx context.Context
+
+	BeforeEach(func() {
+		err = nil
+		ctx = context.Background()
+	})
+
+	It("returns error when creating without url", func() {
+		_, err = NewGiteaGITProvider(ctx, "", "foo")
+		Expect(err).To(MatchError("remoteURL empty"))
+	})
+
+	It("returns error when creating without token", func() {
+		_, err = NewGiteaGITProvider(ctx, "https://gitea.example.com/owner/repo", "")
+		Expect(err).To(MatchError("token empty"))
+	})
+
+	It("returns error when creating with an invalid repository id", func() {
+		_, err = NewGiteaGITProvider(ctx, "https://gitea.example.com/owner/sub/repo", "foo")
+		Expect(err).To(MatchError("invalid repository id \"owner/sub/repo\""))
+	})
+})
+
+var _ = Describe("GiteaGITProvider", func() {
+	var ctx context.Context
+	var standIn *giteaStandIn
+	var server *httptest.Server
+	var provider *GiteaGITProvider
+	state := &PRState{
+		Env:   "dev",
+		Group: "testgroup",
+		App:   "testapp",
+		Tag:   "v1.0.0",
+		Sha:   "",
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		standIn = newGiteaStandIn()
+		server = httptest.NewServer(standIn)
+		var err error
+		provider, err = NewGiteaGITProvider(ctx, fmt.Sprintf("%s/owner/repo.git", server.URL), "token")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	createPR := func(branchName string, auto bool) (int, error) {
+		description, err := state.Description()
+		Expect(err).To(BeNil())
+		return provider.CreatePR(ctx, branchName, DefaultBranch, auto, state.Title(), description)
+	}
+
+	Describe("CreatePR", func() {
+		It("creates a new PR", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(1))
+			Expect(standIn.prs).To(HaveLen(1))
+			Expect(standIn.prs[0].Base.Ref).To(Equal(DefaultBranch))
+			Expect(standIn.scheduled).To(BeEmpty())
+		})
+
+		It("updates an existing PR for the same branch", func() {
+			origID, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			standIn.prs[0].Title = "old title"
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(origID))
+			Expect(standIn.prs).To(HaveLen(1))
+			Expect(standIn.prs[0].Title).To(Equal(state.Title()))
+		})
+
+		It("schedules auto-merge when auto is true", func() {
+			id, err := createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+			Expect(standIn.scheduled[int64(id)]).To(BeTrue())
+		})
+
+		It("accepts an auto-merge that is already scheduled", func() {
+			_, err := createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+			_, err = createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("GetStatus", func() {
+		sha := fmt.Sprintf("%040d", 42)
+
+		It("returns an error when there is no status", func() {
+			_, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(MatchError(fmt.Sprintf("no status found for sha %q", sha)))
+		})
+
+		It("reports the latest status", func() {
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeFalse())
+
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, true)).To(Succeed())
+			status, err = provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+
+		It("matches statuses set by the Flux notification controller", func() {
+			standIn.statuses[sha] = []*gitea.Status{
+				{Context: "kustomization/testgroup-qa/0c9c2e41", State: gitea.StatusFailure},
+				{Context: "kustomization/testgroup-dev/0c9c2e41", State: gitea.StatusSuccess},
+			}
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+	})
+
+	Describe("GetPRWithBranch", func() {
+		It("returns the PR with its state", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			pr, err := provider.GetPRWithBranch(ctx, "promote/testgroup-testapp", DefaultBranch)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+	})
+
+	Describe("MergePR and GetPRThatCausedCommit", func() {
+		It("returns an error when no PR caused the commit", func() {
+			_, err := provider.GetPRThatCausedCommit(ctx, fmt.Sprintf("%040d", 42))
+			Expect(err.Error()).To(ContainSubstring("no PR found for sha:"))
+		})
+
+		It("finds the merged PR from the merge commit", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(provider.MergePR(ctx, id, standIn.prs[0].Head.Sha)).To(Succeed())
+			pr, err := provider.GetPRThatCausedCommit(ctx, *standIn.prs[0].MergedCommitID)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+
+		It("returns an error when the PR head has moved", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			err = provider.MergePR(ctx, id, fmt.Sprintf("%040d", 42))
+			Expect(err).To(MatchError(ContainSubstring("was not merged")))
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -20,16 +21,17 @@ import (
 type GitHubGITProvider struct {
 	authClient *http.Client
 	client     *github.Client
+	graphqlURL string
 	owner      string
 	repo       string
 }
 
 // NewGitHubGITProvider ...
-func NewGitHubGITProvider(ctx context.Context, remoteURL, token string) (*GitHubGITProvider, error) {
+func NewGitHubGITProvider(ctx context.Context, remoteURL, token string, opts ProviderOptions) (*GitHubGITProvider, error) {
 	if remoteURL == "" {
 		return nil, fmt.Errorf("remoteURL empty")
 	}
-	if token == "" {
+	if token == "" && opts.GitHubApp == nil && opts.tokenSource == nil {
 		return nil, fmt.Errorf("token empty")
 	}
 
@@ -37,9 +39,7 @@ func NewGitHubGITProvider(ctx context.Context, remoteURL, token string) (*GitHub
 	if err != nil {
 		return nil, err
 	}
-	if host != "https://github.com" {
-		return nil, fmt.Errorf("host does not start with https://github.com: %s", host)
-	}
+	apiURL, graphqlURL := gitHubAPIURLs(host, opts)
 
 	comp := strings.Split(id, "/")
 	if len(comp) != 2 {
@@ -48,24 +48,66 @@ func NewGitHubGITProvider(ctx context.Context, remoteURL, token string) (*GitHub
 	owner := comp[0]
 	repo := comp[1]
 
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	ts := opts.tokenSource
+	if ts == nil {
+		ts, err = gitHubTokenSource(ctx, apiURL, token, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
 	tc := oauth2.NewClient(ctx, ts)
 	client := github.NewClient(tc)
+	client.BaseURL, err = url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL %q: %w", apiURL, err)
+	}
 
 	return &GitHubGITProvider{
 		authClient: tc,
 		client:     client,
+		graphqlURL: graphqlURL,
 		owner:      owner,
 		repo:       repo,
 	}, nil
 }
 
+// gitHubTokenSource returns a token source for the GitHub App installation when one is
+// configured, otherwise for the static token.
+func gitHubTokenSource(ctx context.Context, apiURL, token string, opts ProviderOptions) (oauth2.TokenSource, error) {
+	if opts.GitHubApp != nil {
+		return NewGitHubAppTokenSource(ctx, apiURL, *opts.GitHubApp)
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+}
+
+// gitHubAPIURLs returns the REST and GraphQL API addresses for a GitHub host. GitHub
+// Enterprise Server serves the APIs under /api on the same host as the repositories.
+func gitHubAPIURLs(host string, opts ProviderOptions) (string, string) {
+	apiURL := "https://api.github.com/"
+	graphqlURL := "https://api.github.com/graphql"
+	if host != "https://github.com" {
+		apiURL = host + "/api/v3/"
+		graphqlURL = host + "/api/graphql"
+	}
+	if opts.GitHubAPIURL != "" {
+		apiURL = opts.GitHubAPIURL
+	}
+	if opts.GitHubGraphQLURL != "" {
+		graphqlURL = opts.GitHubGraphQLURL
+	}
+	// go-github requires the base URL to have a trailing slash.
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	return apiURL, graphqlURL
+}
+
 // CreatePR ...
 //
 //nolint:gocognit //temporary
-func (g *GitHubGITProvider) CreatePR(ctx context.Context, branchName string, auto bool, title, description string) (int, error) {
+func (g *GitHubGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
 	sourceName := branchName
-	targetName := DefaultBranch
+	targetName := targetBranch
 
 	listOpts := &github.PullRequestListOptions{
 		State: "open",
@@ -116,7 +158,7 @@ func (g *GitHubGITProvider) CreatePR(ctx context.Context, branchName string, aut
 	}
 
 	if auto != (pr.GetAutoMerge() != nil) {
-		client := githubv4.NewClient(g.authClient)
+		client := githubv4.NewEnterpriseClient(g.graphqlURL, g.authClient)
 		var mutation struct {
 			EnablePullRequestAutoMerge struct {
 				PullRequest struct {
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v45/github"
+	"golang.org/x/oauth2"
+)
+
+// GitHubAppUsername is the username used for git operations when authenticating as a GitHub App installation.
+const GitHubAppUsername = "x-access-token"
+
+// GitHubAppCredentials identifies a GitHub App installation.
+type GitHubAppCredentials struct {
+	AppID          int64
+	InstallationID int64
+	PrivateKey     []byte
+}
+
+// gitHubAppTokenSource mints installation access tokens for a GitHub App. It is meant to be
+// wrapped with oauth2.ReuseTokenSource so that a new token is only minted when the
+// previous one is about to expire.
+type gitHubAppTokenSource struct {
+	ctx         context.Context
+	client      *github.Client
+	credentials GitHubAppCredentials
+}
+
+// NewGitHubAppTokenSource returns a token source for installation access tokens of a GitHub App,
+// which refreshes the token before it expires.
+func NewGitHubAppTokenSource(ctx context.Context, apiURL string, credentials GitHubAppCredentials) (oauth2.TokenSource, error) {
+	if credentials.AppID == 0 {
+		return nil, fmt.Errorf("GitHub App ID empty")
+	}
+	if credentials.InstallationID == 0 {
+		return nil, fmt.Errorf("GitHub App installation ID empty")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(credentials.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse GitHub App private key: %w", err)
+	}
+
+	// The app itself authenticates with a short lived JWT signed with the private key.
+	appTransport := &gitHubAppTransport{
+		base: http.DefaultTransport,
+		sign: func() (string, error) {
+			now := time.Now()
+			claims := jwt.RegisteredClaims{
+				// Allow for some clock drift between us and GitHub.
+				IssuedAt:  jwt.NewNumericDate(now.Add(-60 * time.Second)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+				Issuer:    fmt.Sprint(credentials.AppID),
+			}
+			return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		},
+	}
+	client := github.NewClient(&http.Client{Transport: appTransport})
+	client.BaseURL, err = url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL %q: %w", apiURL, err)
+	}
+
+	ts := &gitHubAppTokenSource{
+		ctx:         ctx,
+		client:      client,
+		credentials: credentials,
+	}
+	return oauth2.ReuseTokenSource(nil, ts), nil
+}
+
+// Token mints a new installation access token.
+func (s *gitHubAppTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := s.client.Apps.CreateInstallationToken(s.ctx, s.credentials.InstallationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create GitHub App installation token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt(),
+	}, nil
+}
+
+type gitHubAppTransport struct {
+	base http.RoundTripper
+	sign func() (string, error)
+}
+
+func (t *gitHubAppTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed, err := t.sign()
+	if err != nil {
+		return nil, fmt.Errorf("could not sign GitHub App JWT: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+signed)
+	return t.base.RoundTrip(req)
+}
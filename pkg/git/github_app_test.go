@@ -0,0 +1,127 @@
+package git
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// gitHubAppStandIn mints installation tokens and serves commit statuses, checking
+// that requests are authenticated with the expected credentials.
+type gitHubAppStandIn struct {
+	mu        sync.Mutex
+	key       *rsa.PrivateKey
+	lifetime  time.Duration
+	minted    []string
+	lastToken string
+}
+
+func (s *gitHubAppStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/app/installations/42/access_tokens":
+		signed := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims := &jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+			return &s.key.PublicKey, nil
+		})
+		if err != nil || claims.Issuer != "1" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "bad credentials"})
+			return
+		}
+		token := fmt.Sprintf("token-%d", len(s.minted)+1)
+		s.minted = append(s.minted, token)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"token":      token,
+			"expires_at": time.Now().Add(s.lifetime).Format(time.RFC3339),
+		})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v3/repos/org/repo/commits/"):
+		s.lastToken = strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+		writeJSON(w, http.StatusOK, []interface{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var _ = Describe("NewGitHubAppTokenSource", func() {
+	var ctx context.Context
+	var standIn *gitHubAppStandIn
+	var server *httptest.Server
+	var credentials GitHubAppCredentials
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).To(BeNil())
+		standIn = &gitHubAppStandIn{key: key, lifetime: time.Hour}
+		server = httptest.NewServer(standIn)
+		credentials = GitHubAppCredentials{
+			AppID:          1,
+			InstallationID: 42,
+			PrivateKey:     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns error without app id", func() {
+		credentials.AppID = 0
+		_, err := NewGitHubAppTokenSource(ctx, server.URL+"/api/v3/", credentials)
+		Expect(err).To(MatchError("GitHub App ID empty"))
+	})
+
+	It("returns error with an invalid private key", func() {
+		credentials.PrivateKey = []byte("foo")
+		_, err := NewGitHubAppTokenSource(ctx, server.URL+"/api/v3/", credentials)
+		Expect(err).To(MatchError(ContainSubstring("could not parse GitHub App private key")))
+	})
+
+	It("mints an installation token and reuses it while it is valid", func() {
+		ts, err := NewGitHubAppTokenSource(ctx, server.URL+"/api/v3/", credentials)
+		Expect(err).To(BeNil())
+		token, err := ts.Token()
+		Expect(err).To(BeNil())
+		Expect(token.AccessToken).To(Equal("token-1"))
+		token, err = ts.Token()
+		Expect(err).To(BeNil())
+		Expect(token.AccessToken).To(Equal("token-1"))
+		Expect(standIn.minted).To(HaveLen(1))
+	})
+
+	It("mints a new token when the previous one is about to expire", func() {
+		standIn.lifetime = time.Second
+		ts, err := NewGitHubAppTokenSource(ctx, server.URL+"/api/v3/", credentials)
+		Expect(err).To(BeNil())
+		token, err := ts.Token()
+		Expect(err).To(BeNil())
+		Expect(token.AccessToken).To(Equal("token-1"))
+		token, err = ts.Token()
+		Expect(err).To(BeNil())
+		Expect(token.AccessToken).To(Equal("token-2"))
+	})
+
+	It("is used by the GitHub provider when no token is set", func() {
+		opts := ProviderOptions{GitHubApp: &credentials}
+		provider, err := NewGitHubGITProvider(ctx, server.URL+"/org/repo", "", opts)
+		Expect(err).To(BeNil())
+		_, err = provider.GetStatus(ctx, "sha", "group", "env")
+		Expect(err).To(MatchError(ContainSubstring("no status found")))
+		Expect(standIn.lastToken).To(Equal("token-1"))
+	})
+})
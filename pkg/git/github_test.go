@@ -31,9 +31,9 @@ func cloneTestRepoOnExistingBranch(ctx context.Context, branchName string) *Repo
 	tmpDir, e := ioutil.TempDir("", "gitops-promotion")
 	createdRepos = append(createdRepos, tmpDir)
 	Expect(e).To(BeNil())
-	e = Clone(remoteURL, "pat", token, tmpDir, branchName)
+	e = Clone(remoteURL, "pat", token, tmpDir, branchName, nil)
 	Expect(e).To(BeNil())
-	repo, e := LoadRepository(ctx, tmpDir, providerTypeString, token)
+	repo, e := LoadRepository(ctx, tmpDir, providerTypeString, token, RepositoryOptions{})
 	Expect(e).To(BeNil())
 	return repo
 }
@@ -89,18 +89,43 @@ var _ = Describe("NewGitHubGITProvider", func() {
 	})
 
 	It("returns error when creating without url", func() {
-		_, err = NewGitHubGITProvider(ctx, "", "foo")
+		_, err = NewGitHubGITProvider(ctx, "", "foo", ProviderOptions{})
 		Expect(err).To(MatchError("remoteURL empty"))
 	})
 
 	It("returns error when creating without token", func() {
-		_, err = NewGitHubGITProvider(ctx, "https://github.com/org/repo", "")
+		_, err = NewGitHubGITProvider(ctx, "https://github.com/org/repo", "", ProviderOptions{})
 		Expect(err).To(MatchError("token empty"))
 	})
 
-	It("returns error when creating without github address", func() {
-		_, err = NewGitHubGITProvider(ctx, "https://foo.bar/org/repo", "foo")
-		Expect(err).To(MatchError("host does not start with https://github.com: https://foo.bar"))
+	It("uses the public API for github.com", func() {
+		var provider *GitHubGITProvider
+		provider, err = NewGitHubGITProvider(ctx, "https://github.com/org/repo", "foo", ProviderOptions{})
+		Expect(err).To(BeNil())
+		Expect(provider.client.BaseURL.String()).To(Equal("https://api.github.com/"))
+		Expect(provider.graphqlURL).To(Equal("https://api.github.com/graphql"))
+	})
+
+	It("derives the API addresses for a GitHub Enterprise Server host", func() {
+		var provider *GitHubGITProvider
+		provider, err = NewGitHubGITProvider(ctx, "git@github.example.com:org/repo.git", "foo", ProviderOptions{})
+		Expect(err).To(BeNil())
+		Expect(provider.client.BaseURL.String()).To(Equal("https://github.example.com/api/v3/"))
+		Expect(provider.graphqlURL).To(Equal("https://github.example.com/api/graphql"))
+		Expect(provider.owner).To(Equal("org"))
+		Expect(provider.repo).To(Equal("repo"))
+	})
+
+	It("uses the API addresses from the options when set", func() {
+		var provider *GitHubGITProvider
+		opts := ProviderOptions{
+			GitHubAPIURL:     "https://api.github.example.com",
+			GitHubGraphQLURL: "https://api.github.example.com/graphql",
+		}
+		provider, err = NewGitHubGITProvider(ctx, "https://github.example.com/org/repo", "foo", opts)
+		Expect(err).To(BeNil())
+		Expect(provider.client.BaseURL.String()).To(Equal("https://api.github.example.com/"))
+		Expect(provider.graphqlURL).To(Equal("https://api.github.example.com/graphql"))
 	})
 
 	It("is successfully created when creating with correct token", func() {
@@ -112,7 +137,7 @@ var _ = Describe("NewGitHubGITProvider", func() {
 			Skip("GITHUB_URL and/or GITHUB_TOKEN environment variables not set")
 		}
 
-		provider, err = NewGitHubGITProvider(ctx, remoteURL, token)
+		provider, err = NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 		Expect(err).To(BeNil())
 		Expect(remoteURL).To(ContainSubstring(provider.owner))
 		Expect(remoteURL).To(ContainSubstring(provider.repo))
@@ -121,7 +146,7 @@ var _ = Describe("NewGitHubGITProvider", func() {
 
 var _ = Describe("GitHubGITProvider CreatePR", func() {
 	ctx := context.Background()
-	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token)
+	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 
 	BeforeEach(func() {
 		if remoteURL == "" || token == "" {
@@ -151,7 +176,7 @@ var _ = Describe("GitHubGITProvider CreatePR", func() {
 		description, err := state.Description()
 		Expect(err).To(BeNil())
 		//nolint:ineffassign,staticcheck // ignore
-		prid, err = provider.CreatePR(ctx, branchName, auto, title, description)
+		prid, err = provider.CreatePR(ctx, branchName, DefaultBranch, auto, title, description)
 	})
 
 	When("Creating PR with empty values", func() {
@@ -220,7 +245,7 @@ var _ = Describe("GitHubGITProvider CreatePR", func() {
 			title := state.Title()
 			description, err := state.Description()
 			Expect(err).To(BeNil())
-			origPRId, e = provider.CreatePR(ctx, branchName, false, title, description)
+			origPRId, e = provider.CreatePR(ctx, branchName, DefaultBranch, false, title, description)
 			Expect(e).To(BeNil())
 		})
 
@@ -284,7 +309,7 @@ var _ = Describe("GitHubGITProvider CreatePR", func() {
 
 var _ = Describe("GitHubGITProvider GetStatus", func() {
 	ctx := context.Background()
-	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token)
+	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 
 	BeforeEach(func() {
 		if remoteURL == "" || token == "" {
@@ -372,7 +397,7 @@ var _ = Describe("GitHubGITProvider GetStatus", func() {
 
 var _ = Describe("GitHubGITProvider MergePR", func() {
 	ctx := context.Background()
-	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token)
+	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 
 	BeforeEach(func() {
 		if remoteURL == "" || token == "" {
@@ -424,7 +449,7 @@ var _ = Describe("GitHubGITProvider MergePR", func() {
 			title := state.Title()
 			description, err := state.Description()
 			Expect(err).To(BeNil())
-			_, e := provider.CreatePR(ctx, branchName, false, title, description)
+			_, e := provider.CreatePR(ctx, branchName, DefaultBranch, false, title, description)
 			Expect(e).To(BeNil())
 
 			pr, e := provider.GetPRWithBranch(ctx, branchName, DefaultBranch)
@@ -441,7 +466,7 @@ var _ = Describe("GitHubGITProvider MergePR", func() {
 
 var _ = Describe("GitHubGITProvider GetPRWithBranch", func() {
 	ctx := context.Background()
-	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token)
+	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 
 	BeforeEach(func() {
 		if remoteURL == "" || token == "" {
@@ -490,7 +515,7 @@ var _ = Describe("GitHubGITProvider GetPRWithBranch", func() {
 			title := state.Title()
 			description, err := state.Description()
 			Expect(err).To(BeNil())
-			origPRId, e = provider.CreatePR(ctx, branchName, false, title, description)
+			origPRId, e = provider.CreatePR(ctx, branchName, DefaultBranch, false, title, description)
 			Expect(e).To(BeNil())
 		})
 
@@ -503,7 +528,7 @@ var _ = Describe("GitHubGITProvider GetPRWithBranch", func() {
 
 var _ = Describe("GitHubGITProvider GetPRThatCausedCommit", func() {
 	ctx := context.Background()
-	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token)
+	provider, providerErr := NewGitHubGITProvider(ctx, remoteURL, token, ProviderOptions{})
 
 	BeforeEach(func() {
 		if remoteURL == "" || token == "" {
@@ -549,7 +574,7 @@ var _ = Describe("GitHubGITProvider GetPRThatCausedCommit", func() {
 			title := state.Title()
 			description, err := state.Description()
 			Expect(err).To(BeNil())
-			_, e := provider.CreatePR(ctx, branchName, false, title, description)
+			_, e := provider.CreatePR(ctx, branchName, DefaultBranch, false, title, description)
 			Expect(e).To(BeNil())
 
 			mergedPR, e = provider.GetPRWithBranch(ctx, branchName, DefaultBranch)
@@ -0,0 +1,282 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/xanzy/go-gitlab"
+)
+
+// GitLabGITProvider ...
+type GitLabGITProvider struct {
+	client  *gitlab.Client
+	project string
+}
+
+// NewGitLabGITProvider ...
+func NewGitLabGITProvider(ctx context.Context, remoteURL, token string) (*GitLabGITProvider, error) {
+	if remoteURL == "" {
+		return nil, fmt.Errorf("remoteURL empty")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token empty")
+	}
+
+	host, id, err := ParseGitAddress(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// GitLab supports nested groups so the project path can contain any
+	// number of namespaces, but it always has to have at least one.
+	comp := strings.Split(id, "/")
+	if len(comp) < 2 {
+		return nil, fmt.Errorf("invalid repository id %q", id)
+	}
+
+	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(host))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitLabGITProvider{
+		client:  client,
+		project: id,
+	}, nil
+}
+
+// CreatePR ...
+func (g *GitLabGITProvider) CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error) {
+	sourceName := branchName
+	targetName := targetBranch
+
+	listOpts := &gitlab.ListProjectMergeRequestsOptions{
+		State:        gitlab.String("opened"),
+		SourceBranch: &sourceName,
+		TargetBranch: &targetName,
+	}
+	openMrs, _, err := g.client.MergeRequests.ListProjectMergeRequests(g.project, listOpts, gitlab.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	var mr *gitlab.MergeRequest
+	switch len(openMrs) {
+	case 0:
+		createOpts := &gitlab.CreateMergeRequestOptions{
+			Title:              &title,
+			Description:        &description,
+			SourceBranch:       &sourceName,
+			TargetBranch:       &targetName,
+			RemoveSourceBranch: gitlab.Bool(true),
+		}
+		mr, _, err = g.client.MergeRequests.CreateMergeRequest(g.project, createOpts, gitlab.WithContext(ctx))
+		if err == nil {
+			log.Printf("Created new MR !%d merging %s -> %s\n", mr.IID, sourceName, targetName)
+		}
+	case 1:
+		updateOpts := &gitlab.UpdateMergeRequestOptions{
+			Title:       &title,
+			Description: &description,
+		}
+		mr, _, err = g.client.MergeRequests.UpdateMergeRequest(g.project, openMrs[0].IID, updateOpts, gitlab.WithContext(ctx))
+		if err == nil {
+			log.Printf("Updated MR !%d merging %s -> %s\n", mr.IID, sourceName, targetName)
+		}
+	default:
+		return 0, fmt.Errorf("received more than one MRs when listing: %d", len(openMrs))
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if auto && !mr.MergeWhenPipelineSucceeds {
+		acceptOpts := &gitlab.AcceptMergeRequestOptions{
+			MergeWhenPipelineSucceeds: gitlab.Bool(true),
+			ShouldRemoveSourceBranch:  gitlab.Bool(true),
+		}
+		_, _, err = g.client.MergeRequests.AcceptMergeRequest(g.project, mr.IID, acceptOpts, gitlab.WithContext(ctx))
+		if err == nil {
+			log.Printf("Merge when pipeline succeeds activated for MR !%d\n", mr.IID)
+		} else {
+			log.Printf("Failed to activate merge when pipeline succeeds for MR !%d: %v", mr.IID, err)
+			err = fmt.Errorf("could not set merge when pipeline succeeds on MR !%d: %w", mr.IID, err)
+		}
+	}
+	return mr.IID, err
+}
+
+func (g *GitLabGITProvider) GetStatus(ctx context.Context, sha string, group string, env string) (CommitStatus, error) {
+	// Only the latest status of each name is returned when all is not set
+	opts := &gitlab.GetCommitStatusesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	statuses := []*gitlab.CommitStatus{}
+	for {
+		page, resp, err := g.client.Commits.GetCommitStatuses(g.project, sha, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return CommitStatus{}, err
+		}
+		statuses = append(statuses, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	var displays = make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		displays = append(displays, fmt.Sprintf("%s: %s (%s)", s.Name, s.Status, s.Description))
+	}
+	log.Printf("Considering statuses %v\n", displays)
+
+	// The statuses are sorted by id in ascending order, so the last match is the most recent
+	// status for the environment. Statuses of CI jobs, like build or test, are not in the
+	// kind/<group>-<env> format and are skipped.
+	name := fmt.Sprintf("%s-%s", group, env)
+	var latest *gitlab.CommitStatus
+	for _, s := range statuses {
+		comp := strings.Split(s.Name, "/")
+		if len(comp) < 2 || comp[1] != name {
+			continue
+		}
+		if latest == nil || s.ID > latest.ID {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return CommitStatus{}, fmt.Errorf("no status found for sha %q", sha)
+	}
+	return CommitStatus{
+		Succeeded: latest.Status == string(gitlab.Success),
+	}, nil
+}
+
+func (g *GitLabGITProvider) SetStatus(ctx context.Context, sha string, group string, env string, succeeded bool) error {
+	description := fmt.Sprintf("%s-%s-%s", group, env, sha)
+	name := fmt.Sprintf("kind/%s-%s", group, env)
+
+	state := gitlab.Success
+	if !succeeded {
+		state = gitlab.Failed
+	}
+
+	opts := &gitlab.SetCommitStatusOptions{
+		State:       state,
+		Name:        &name,
+		Description: &description,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, _, err := g.client.Commits.SetCommitStatus(g.project, sha, opts, gitlab.WithContext(ctx))
+	return err
+}
+
+func (g *GitLabGITProvider) MergePR(ctx context.Context, id int, sha string) error {
+	opts := &gitlab.AcceptMergeRequestOptions{
+		SHA:                      &sha,
+		ShouldRemoveSourceBranch: gitlab.Bool(true),
+	}
+
+	var mr *gitlab.MergeRequest
+	err := retry.Do(
+		func() error {
+			var err error
+			var res *gitlab.Response
+			mr, res, err = g.client.MergeRequests.AcceptMergeRequest(g.project, id, opts, gitlab.WithContext(ctx))
+			// GitLab responds with 406 when the source branch has to be rebased before it can be merged.
+			if err != nil && res != nil && res.StatusCode == http.StatusNotAcceptable {
+				_, innerErr := g.client.MergeRequests.RebaseMergeRequest(g.project, id, gitlab.WithContext(ctx))
+				if innerErr != nil {
+					return innerErr
+				}
+			}
+			return err
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if mr.State != "merged" {
+		return fmt.Errorf("MR with ID %d was not merged: %s", id, mr.MergeError)
+	}
+
+	return nil
+}
+
+func (g *GitLabGITProvider) GetPRWithBranch(ctx context.Context, source, target string) (PullRequest, error) {
+	listOpts := &gitlab.ListProjectMergeRequestsOptions{
+		State:        gitlab.String("opened"),
+		SourceBranch: &source,
+		TargetBranch: &target,
+	}
+
+	var mrs []*gitlab.MergeRequest
+	err := retry.Do(
+		func() error {
+			var err error
+			mrs, _, err = g.client.MergeRequests.ListProjectMergeRequests(g.project, listOpts, gitlab.WithContext(ctx))
+			if err != nil {
+				return err
+			}
+			if len(mrs) != 1 {
+				return fmt.Errorf("no PR found for branches %q-%q", source, target)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+
+	mr := mrs[0]
+
+	return NewPullRequest(&mr.IID, &mr.Title, &mr.Description)
+}
+
+func (g *GitLabGITProvider) GetPRThatCausedCommit(ctx context.Context, sha string) (PullRequest, error) {
+	var mrs []*gitlab.MergeRequest
+	err := retry.Do(
+		func() error {
+			commitMrs, _, err := g.client.Commits.ListMergeRequestsByCommit(g.project, sha, gitlab.WithContext(ctx))
+			if err != nil {
+				return err
+			}
+			mrs = nil
+			for _, mr := range commitMrs {
+				if mr == nil || mr.State != "merged" {
+					continue
+				}
+				// Depending on the merge method the commit is either a merge commit,
+				// a squash commit or the head of a fast-forwarded source branch.
+				if sha == mr.MergeCommitSHA || sha == mr.SquashCommitSHA || sha == mr.SHA {
+					mrs = append(mrs, mr)
+				}
+			}
+			if len(mrs) != 1 {
+				return fmt.Errorf("no PR found for sha: %s", sha)
+			}
+			return nil
+		},
+		retry.Attempts(5),
+		retry.LastErrorOnly(true),
+	)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	mr := mrs[0]
+
+	return NewPullRequest(&mr.IID, &mr.Title, &mr.Description)
+}
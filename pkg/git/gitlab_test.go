@@ -0,0 +1,348 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/xanzy/go-gitlab"
+)
+
+const gitLabTestProject = "group/subgroup/repo"
+
+// gitLabStandIn keeps merge requests, the merge requests of merge commits and commit statuses of
+// a single project in memory, and serves them like the GitLab v4 API. Merge requests are merged
+// by their iid and get a merge commit derived from it.
+type gitLabStandIn struct {
+	standInRouter
+	mrs      []*gitlab.MergeRequest
+	statuses map[string][]*gitlab.CommitStatus
+	statusID int
+	commits  map[string][]int
+}
+
+func newGitLabStandIn() *gitLabStandIn {
+	s := &gitLabStandIn{
+		statuses: map[string][]*gitlab.CommitStatus{},
+		commits:  map[string][]int{},
+	}
+	prefix := "/api/v4/projects/" + strings.ReplaceAll(gitLabTestProject, "/", "%2F")
+	s.handle(http.MethodGet, prefix+"/merge_requests", s.listMergeRequests)
+	s.handle(http.MethodPost, prefix+"/merge_requests", s.createMergeRequest)
+	s.handle(http.MethodPut, prefix+"/merge_requests/*", s.updateMergeRequest)
+	s.handle(http.MethodPut, prefix+"/merge_requests/*/merge", s.acceptMergeRequest)
+	s.handle(http.MethodGet, prefix+"/repository/commits/*/statuses", s.listStatuses)
+	s.handle(http.MethodGet, prefix+"/repository/commits/*/merge_requests", s.listCommitMergeRequests)
+	s.handle(http.MethodPost, prefix+"/statuses/*", s.setStatus)
+	return s
+}
+
+func (s *gitLabStandIn) listMergeRequests(w http.ResponseWriter, r *http.Request, _ []string) {
+	q := r.URL.Query()
+	result := []*gitlab.MergeRequest{}
+	for _, mr := range s.mrs {
+		if q.Get("state") != "" && mr.State != q.Get("state") {
+			continue
+		}
+		if q.Get("source_branch") != "" && mr.SourceBranch != q.Get("source_branch") {
+			continue
+		}
+		if q.Get("target_branch") != "" && mr.TargetBranch != q.Get("target_branch") {
+			continue
+		}
+		result = append(result, mr)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *gitLabStandIn) createMergeRequest(w http.ResponseWriter, r *http.Request, _ []string) {
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	mr := &gitlab.MergeRequest{
+		IID:          len(s.mrs) + 1,
+		Title:        fmt.Sprint(body["title"]),
+		Description:  fmt.Sprint(body["description"]),
+		SourceBranch: fmt.Sprint(body["source_branch"]),
+		TargetBranch: fmt.Sprint(body["target_branch"]),
+		State:        "opened",
+		SHA:          fmt.Sprintf("%040d", len(s.mrs)+1),
+	}
+	s.mrs = append(s.mrs, mr)
+	writeJSON(w, http.StatusCreated, mr)
+}
+
+func (s *gitLabStandIn) updateMergeRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.mrs))
+	if i < 0 {
+		return
+	}
+	mr := s.mrs[i]
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	if v, ok := body["title"]; ok {
+		mr.Title = fmt.Sprint(v)
+	}
+	if v, ok := body["description"]; ok {
+		mr.Description = fmt.Sprint(v)
+	}
+	writeJSON(w, http.StatusOK, mr)
+}
+
+func (s *gitLabStandIn) acceptMergeRequest(w http.ResponseWriter, r *http.Request, params []string) {
+	i := standInLookup(w, r, params[0], len(s.mrs))
+	if i < 0 {
+		return
+	}
+	mr := s.mrs[i]
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	if v, ok := body["merge_when_pipeline_succeeds"]; ok && v == true {
+		mr.MergeWhenPipelineSucceeds = true
+		writeJSON(w, http.StatusOK, mr)
+		return
+	}
+	if v, ok := body["sha"]; ok && v != mr.SHA {
+		writeJSON(w, http.StatusConflict, map[string]string{"message": "SHA does not match HEAD of source branch"})
+		return
+	}
+	mr.State = "merged"
+	mr.MergeCommitSHA = fmt.Sprintf("%040d", 1000+mr.IID)
+	s.commits[mr.MergeCommitSHA] = append(s.commits[mr.MergeCommitSHA], mr.IID)
+	writeJSON(w, http.StatusOK, mr)
+}
+
+// listStatuses returns the statuses of the commit in ascending order of id. Like the GitLab API
+// only the latest status of each name is returned unless all is set, and the statuses are paged.
+func (s *gitLabStandIn) listStatuses(w http.ResponseWriter, r *http.Request, params []string) {
+	latest := map[string]int{}
+	for _, status := range s.statuses[params[0]] {
+		latest[status.Name] = status.ID
+	}
+	statuses := []*gitlab.CommitStatus{}
+	for _, status := range s.statuses[params[0]] {
+		if r.URL.Query().Get("all") == "true" || latest[status.Name] == status.ID {
+			statuses = append(statuses, status)
+		}
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 20
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	start := (page - 1) * perPage
+	if start > len(statuses) {
+		start = len(statuses)
+	}
+	end := start + perPage
+	if end < len(statuses) {
+		w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+	} else {
+		end = len(statuses)
+	}
+	writeJSON(w, http.StatusOK, statuses[start:end])
+}
+
+func (s *gitLabStandIn) listCommitMergeRequests(w http.ResponseWriter, _ *http.Request, params []string) {
+	result := []*gitlab.MergeRequest{}
+	for _, iid := range s.commits[params[0]] {
+		result = append(result, s.mrs[iid-1])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *gitLabStandIn) setStatus(w http.ResponseWriter, r *http.Request, params []string) {
+	body := map[string]interface{}{}
+	readJSON(r, &body)
+	s.statusID++
+	status := &gitlab.CommitStatus{
+		ID:          s.statusID,
+		SHA:         params[0],
+		Name:        fmt.Sprint(body["name"]),
+		Status:      fmt.Sprint(body["state"]),
+		Description: fmt.Sprint(body["description"]),
+	}
+	s.statuses[params[0]] = append(s.statuses[params[0]], status)
+	writeJSON(w, http.StatusCreated, status)
+}
+
+var _ = Describe("NewGitLabGITProvider", func() {
+	var err error
+	var ctx context.Context
+
+	BeforeEach(func() {
+		err = nil
+		ctx = context.Background()
+	})
+
+	It("returns error when creating without url", func() {
+		_, err = NewGitLabGITProvider(ctx, "", "foo")
+		Expect(err).To(MatchError("remoteURL empty"))
+	})
+
+	It("returns error when creating without token", func() {
+		_, err = NewGitLabGITProvider(ctx, "https://gitlab.com/group/repo", "")
+		Expect(err).To(MatchError("token empty"))
+	})
+
+	It("returns error when creating without a namespace", func() {
+		_, err = NewGitLabGITProvider(ctx, "https://gitlab.com/repo", "foo")
+		Expect(err).To(MatchError("invalid repository id \"repo\""))
+	})
+
+	It("is successfully created with a nested group", func() {
+		var provider *GitLabGITProvider
+		provider, err = NewGitLabGITProvider(ctx, "https://gitlab.example.com/group/subgroup/repo.git", "foo")
+		Expect(err).To(BeNil())
+		Expect(provider.project).To(Equal("group/subgroup/repo"))
+		Expect(provider.client.BaseURL().String()).To(Equal("https://gitlab.example.com/api/v4/"))
+	})
+})
+
+var _ = Describe("GitLabGITProvider", func() {
+	var ctx context.Context
+	var standIn *gitLabStandIn
+	var server *httptest.Server
+	var provider *GitLabGITProvider
+	state := &PRState{
+		Env:   "dev",
+		Group: "testgroup",
+		App:   "testapp",
+		Tag:   "v1.0.0",
+		Sha:   "",
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		standIn = newGitLabStandIn()
+		server = httptest.NewServer(standIn)
+		var err error
+		provider, err = NewGitLabGITProvider(ctx, fmt.Sprintf("%s/%s.git", server.URL, gitLabTestProject), "token")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	createPR := func(branchName string, auto bool) (int, error) {
+		description, err := state.Description()
+		Expect(err).To(BeNil())
+		return provider.CreatePR(ctx, branchName, DefaultBranch, auto, state.Title(), description)
+	}
+
+	Describe("CreatePR", func() {
+		It("creates a new MR", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(1))
+			Expect(standIn.mrs).To(HaveLen(1))
+			Expect(standIn.mrs[0].TargetBranch).To(Equal(DefaultBranch))
+			Expect(standIn.mrs[0].MergeWhenPipelineSucceeds).To(BeFalse())
+		})
+
+		It("updates an existing MR for the same branch", func() {
+			origID, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			standIn.mrs[0].Title = "old title"
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(origID))
+			Expect(standIn.mrs).To(HaveLen(1))
+			Expect(standIn.mrs[0].Title).To(Equal(state.Title()))
+		})
+
+		It("sets merge when pipeline succeeds when auto is true", func() {
+			_, err := createPR("promote/testgroup-testapp", true)
+			Expect(err).To(BeNil())
+			Expect(standIn.mrs[0].MergeWhenPipelineSucceeds).To(BeTrue())
+		})
+	})
+
+	Describe("GetStatus", func() {
+		sha := fmt.Sprintf("%040d", 42)
+
+		It("returns an error when there is no status", func() {
+			_, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(MatchError(fmt.Sprintf("no status found for sha %q", sha)))
+		})
+
+		It("reports failure", func() {
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeFalse())
+		})
+
+		It("reports success from the latest status", func() {
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, true)).To(Succeed())
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+
+		It("reports success after an earlier failure with many other statuses", func() {
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, false)).To(Succeed())
+			for i := 0; i < 150; i++ {
+				Expect(provider.SetStatus(ctx, sha, "othergroup", fmt.Sprintf("env%d", i), false)).To(Succeed())
+			}
+			Expect(provider.SetStatus(ctx, sha, state.Group, state.Env, true)).To(Succeed())
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+
+		It("matches statuses set by the Flux notification controller", func() {
+			standIn.statuses[sha] = []*gitlab.CommitStatus{
+				{ID: 1, Name: "build", Status: "success"},
+				{ID: 2, Name: "kustomization/testgroup-qa/0c9c2e41", Status: "failed"},
+				{ID: 3, Name: "kustomization/testgroup-dev/0c9c2e41", Status: "success"},
+				{ID: 4, Name: "test", Status: "failed"},
+			}
+			status, err := provider.GetStatus(ctx, sha, state.Group, state.Env)
+			Expect(err).To(BeNil())
+			Expect(status.Succeeded).To(BeTrue())
+		})
+	})
+
+	Describe("GetPRWithBranch", func() {
+		It("returns an error when there is no MR", func() {
+			_, err := provider.GetPRWithBranch(ctx, "promote/testgroup-testapp", DefaultBranch)
+			Expect(err.Error()).To(ContainSubstring("no PR found for branches"))
+		})
+
+		It("returns the MR with its state", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			pr, err := provider.GetPRWithBranch(ctx, "promote/testgroup-testapp", DefaultBranch)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+	})
+
+	Describe("MergePR and GetPRThatCausedCommit", func() {
+		It("returns an error when no MR caused the commit", func() {
+			_, err := provider.GetPRThatCausedCommit(ctx, fmt.Sprintf("%040d", 42))
+			Expect(err.Error()).To(ContainSubstring("no PR found for sha:"))
+		})
+
+		It("finds the merged MR from the merge commit", func() {
+			id, err := createPR("promote/testgroup-testapp", false)
+			Expect(err).To(BeNil())
+			Expect(provider.MergePR(ctx, id, standIn.mrs[0].SHA)).To(Succeed())
+			pr, err := provider.GetPRThatCausedCommit(ctx, standIn.mrs[0].MergeCommitSHA)
+			Expect(err).To(BeNil())
+			Expect(pr.ID).To(Equal(id))
+			Expect(pr.State).To(Equal(state))
+		})
+	})
+})
@@ -3,6 +3,8 @@ package git
 import (
 	"context"
 	"fmt"
+
+	"golang.org/x/oauth2"
 )
 
 type ProviderType string
@@ -10,23 +12,49 @@ type ProviderType string
 const (
 	ProviderTypeAzdo   ProviderType = "azdo"
 	ProviderTypeGitHub ProviderType = "github"
+	ProviderTypeGitLab ProviderType = "gitlab"
+	ProviderTypeGitea  ProviderType = "gitea"
+
+	ProviderTypeBitbucketServer ProviderType = "bitbucketserver"
+	ProviderTypeFake            ProviderType = "fake"
 )
 
 type GitProvider interface {
 	GetStatus(ctx context.Context, sha, group, env string) (CommitStatus, error)
 	SetStatus(ctx context.Context, sha string, group string, env string, succeeded bool) error
-	CreatePR(ctx context.Context, branchName string, auto bool, title, description string) (int, error)
+	CreatePR(ctx context.Context, branchName, targetBranch string, auto bool, title, description string) (int, error)
 	GetPRWithBranch(ctx context.Context, source, target string) (PullRequest, error)
 	GetPRThatCausedCommit(ctx context.Context, sha string) (PullRequest, error)
 	MergePR(ctx context.Context, ID int, sha string) error
 }
 
-func NewGitProvider(ctx context.Context, providerType ProviderType, remoteURL, token string) (GitProvider, error) {
+// ProviderOptions contains provider specific settings that can not be derived from the remote URL.
+type ProviderOptions struct {
+	// GitHubAPIURL overrides the GitHub REST API address.
+	GitHubAPIURL string
+	// GitHubGraphQLURL overrides the GitHub GraphQL API address.
+	GitHubGraphQLURL string
+	// GitHubApp authenticates the GitHub provider as a GitHub App installation instead of with the token.
+	GitHubApp *GitHubAppCredentials
+
+	// tokenSource is shared between the provider and the git operations of a repository.
+	tokenSource oauth2.TokenSource
+}
+
+func NewGitProvider(ctx context.Context, providerType ProviderType, remoteURL, token string, opts ProviderOptions) (GitProvider, error) {
 	switch providerType {
 	case ProviderTypeAzdo:
 		return NewAzdoGITProvider(ctx, remoteURL, token)
 	case ProviderTypeGitHub:
-		return NewGitHubGITProvider(ctx, remoteURL, token)
+		return NewGitHubGITProvider(ctx, remoteURL, token, opts)
+	case ProviderTypeGitLab:
+		return NewGitLabGITProvider(ctx, remoteURL, token)
+	case ProviderTypeGitea:
+		return NewGiteaGITProvider(ctx, remoteURL, token)
+	case ProviderTypeBitbucketServer:
+		return NewBitbucketServerGITProvider(ctx, remoteURL, token)
+	case ProviderTypeFake:
+		return NewFakeGITProvider(ctx, remoteURL, token)
 	default:
 		return nil, fmt.Errorf("unknown provider type: %s", providerType)
 	}
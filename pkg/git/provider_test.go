@@ -23,18 +23,25 @@ func TestNewGitProvider(t *testing.T) {
 			expectedErr:  "TF400813: The user 'aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa' is not authorized to access this resource.",
 		},
 		{
-			name:         "fake provider returns error",
-			providerType: ProviderType("fake"),
+			name:         "unknown provider returns error",
+			providerType: ProviderType("unknown"),
 			remoteURL:    "",
 			token:        "",
-			expectedErr:  "unknown provider type: fake",
+			expectedErr:  "unknown provider type: unknown",
+		},
+		{
+			name:         "fake provider returns error for remote path",
+			providerType: ProviderTypeFake,
+			remoteURL:    "https://example.com/org/repo",
+			token:        "",
+			expectedErr:  "remote is not a local path: https://example.com/org/repo",
 		},
 	}
 
 	for i, tt := range tests {
 		t.Logf("Test iteration %d: %s", i, tt.name)
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewGitProvider(context.TODO(), tt.providerType, tt.remoteURL, tt.token)
+			_, err := NewGitProvider(context.TODO(), tt.providerType, tt.remoteURL, tt.token, ProviderOptions{})
 			require.EqualError(t, err, tt.expectedErr)
 		})
 	}
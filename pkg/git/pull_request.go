@@ -1,10 +1,12 @@
 package git
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"strings"
+	"text/template"
 )
 
 const (
@@ -52,6 +54,7 @@ type PRState struct {
 	Group   string `json:"group"`
 	App     string `json:"app"`
 	Tag     string `json:"tag"`
+	Digest  string `json:"digest,omitempty"`
 	Env     string `json:"env"`
 	Sha     string `json:"sha"`
 	Feature string `json:"feature"`
@@ -115,15 +118,37 @@ func (p *PRState) Title() string {
 }
 
 func (p *PRState) Description() (string, error) {
+	body := fmt.Sprintf(`	ENV: %s
+	APP: %s
+	TAG: %s`, p.Env, p.App, p.Tag)
+	if p.Digest != "" {
+		body = fmt.Sprintf("%s\n\tDIGEST: %s", body, p.Digest)
+	}
+	return p.DescriptionWithBody(body)
+}
+
+// DescriptionWithBody returns a pull request description with the given body. The state
+// metadata is always included so that it can be read back with NewPRState.
+func (p *PRState) DescriptionWithBody(body string) (string, error) {
 	jsonString, err := json.Marshal(p)
 	if err != nil {
 		return "", err
 	}
-	description := fmt.Sprintf(`<!-- metadata = %s -->
-	ENV: %s
-	APP: %s
-	TAG: %s`, string(jsonString), p.Env, p.App, p.Tag)
-	return description, nil
+	return fmt.Sprintf("<!-- metadata = %s -->\n%s", string(jsonString), body), nil
+}
+
+// Render executes the Go template text with the state as data.
+func (p *PRState) Render(text string) (string, error) {
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, p)
+	if err != nil {
+		return "", fmt.Errorf("could not render template: %w", err)
+	}
+	return buf.String(), nil
 }
 
 func (p *PRState) EnvPath() string {
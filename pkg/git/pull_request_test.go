@@ -2,6 +2,7 @@ package git
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -86,6 +87,18 @@ func TestPRStateValid(t *testing.T) {
 	require.Equal(t, description, genDescription)
 }
 
+func TestPRStateDigest(t *testing.T) {
+	json := `{"group":"g","app":"a","tag":"t","digest":"sha256:d","env":"e","sha":"s","feature":"","type":"promote"}`
+	description := fmt.Sprintf("<!-- metadata = %s -->\n\tENV: e\n\tAPP: a\n\tTAG: t\n\tDIGEST: sha256:d", json)
+	state, ok, err := NewPRState(description)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "sha256:d", state.Digest)
+	genDescription, err := state.Description()
+	require.NoError(t, err)
+	require.Equal(t, description, genDescription)
+}
+
 func TestPRStateInvalid(t *testing.T) {
 	description := "<!-- metadata = {{ asdasd } -->"
 	_, ok, err := NewPRState(description)
@@ -165,3 +178,57 @@ func TestPRStateBranchName(t *testing.T) {
 		})
 	}
 }
+
+func TestPRStateDescriptionWithBody(t *testing.T) {
+	state := &PRState{Group: "g", App: "a", Tag: "t", Env: "e", Sha: "s", Type: PRTypePromote}
+	description, err := state.DescriptionWithBody("Refs JIRA-123")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(description, "\nRefs JIRA-123"))
+	parsed, ok, err := NewPRState(description)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, state, parsed)
+}
+
+func TestPRStateRender(t *testing.T) {
+	state := &PRState{Group: "g", App: "a", Tag: "t", Env: "e", Type: PRTypePromote}
+	cases := []struct {
+		name        string
+		text        string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "fields",
+			text:     "chore({{ .Group }}): deploy {{ .App }}:{{ .Tag }} to {{ .Env }}",
+			expected: "chore(g): deploy a:t to e",
+		},
+		{
+			name:     "default title",
+			text:     "{{ .Title }} [skip ci]",
+			expected: "Promote g/a version t to environment e [skip ci]",
+		},
+		{
+			name:        "invalid template",
+			text:        "{{ .Group",
+			expectedErr: "could not parse template",
+		},
+		{
+			name:        "unknown field",
+			text:        "{{ .Foo }}",
+			expectedErr: "could not render template",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := state.Render(c.text)
+			if c.expectedErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, out)
+		})
+	}
+}
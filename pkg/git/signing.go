@@ -0,0 +1,159 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck // deprecated, but the only OpenPGP implementation in our dependencies
+	"golang.org/x/crypto/ssh"
+)
+
+type SigningFormat string
+
+const (
+	SigningFormatGPG SigningFormat = "gpg"
+	SigningFormatSSH SigningFormat = "ssh"
+)
+
+// SigningOptions configures signing of the commits created by gitops-promotion.
+type SigningOptions struct {
+	Format     SigningFormat
+	KeyPath    string
+	Passphrase string
+}
+
+// commitSigner returns the signature to store in the gpgsig header of a commit.
+type commitSigner interface {
+	sign(content []byte) (string, error)
+}
+
+func newCommitSigner(opts *SigningOptions) (commitSigner, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	if opts.KeyPath == "" {
+		return nil, fmt.Errorf("signing key path empty")
+	}
+	switch opts.Format {
+	case SigningFormatGPG:
+		return newGPGSigner(opts.KeyPath, opts.Passphrase)
+	case SigningFormatSSH:
+		signer, err := readSSHSigner(opts.KeyPath, opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return &sshSigner{signer: signer}, nil
+	default:
+		return nil, fmt.Errorf("invalid signing format %q", opts.Format)
+	}
+}
+
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+func newGPGSigner(path, passphrase string) (*gpgSigner, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read GPG key: %w", err)
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse GPG key: %w", err)
+	}
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		// The primary key and any subkeys are decrypted as the signing key may be either.
+		if entity.PrivateKey.Encrypted {
+			err := entity.PrivateKey.Decrypt([]byte(passphrase))
+			if err != nil {
+				return nil, fmt.Errorf("could not decrypt GPG key: %w", err)
+			}
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+				err := subkey.PrivateKey.Decrypt([]byte(passphrase))
+				if err != nil {
+					return nil, fmt.Errorf("could not decrypt GPG subkey: %w", err)
+				}
+			}
+		}
+		return &gpgSigner{entity: entity}, nil
+	}
+	return nil, fmt.Errorf("no GPG private key found in %s", path)
+}
+
+func (s *gpgSigner) sign(content []byte) (string, error) {
+	var buf bytes.Buffer
+	err := openpgp.ArmoredDetachSign(&buf, s.entity, bytes.NewReader(content), nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create GPG signature: %w", err)
+	}
+	return buf.String(), nil
+}
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigVersion   = 1
+	sshSigNamespace = "git"
+	sshSigHashAlg   = "sha512"
+)
+
+// sshSigner creates signatures in the SSHSIG format, which is what git uses for gpg.format=ssh.
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func (s *sshSigner) sign(content []byte) (string, error) {
+	hash := sha512.Sum512(content)
+	signedData := struct {
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Hash      string
+	}{sshSigNamespace, "", sshSigHashAlg, string(hash[:])}
+	message := append([]byte(sshSigMagic), ssh.Marshal(signedData)...)
+
+	var sig *ssh.Signature
+	var err error
+	// Signatures with SHA-1 are not accepted by git, so RSA keys have to sign with SHA-512.
+	if algorithmSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = algorithmSigner.SignWithAlgorithm(rand.Reader, message, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, message)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not create SSH signature: %w", err)
+	}
+
+	blob := struct {
+		Version   uint32
+		PublicKey string
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Signature string
+	}{sshSigVersion, string(s.signer.PublicKey().Marshal()), sshSigNamespace, "", sshSigHashAlg, string(ssh.Marshal(sig))}
+	encoded := base64.StdEncoding.EncodeToString(append([]byte(sshSigMagic), ssh.Marshal(blob)...))
+
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString("-----END SSH SIGNATURE-----\n")
+	return armored.String(), nil
+}
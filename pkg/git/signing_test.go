@@ -0,0 +1,166 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git2go "github.com/libgit2/git2go/v33"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"       //nolint:staticcheck // deprecated, but the only OpenPGP implementation in our dependencies
+	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck // deprecated, but the only OpenPGP implementation in our dependencies
+	"golang.org/x/crypto/ssh"
+)
+
+// signingVerifySSH verifies an armored SSHSIG signature of content made with key in the git namespace.
+func signingVerifySSH(key ssh.PublicKey, content, armored string) error {
+	armored = strings.TrimPrefix(armored, "-----BEGIN SSH SIGNATURE-----\n")
+	armored = strings.TrimSuffix(armored, "-----END SSH SIGNATURE-----\n")
+	b, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(armored, "\n", ""))
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(b, []byte(sshSigMagic)) {
+		return fmt.Errorf("missing magic preamble")
+	}
+	blob := struct {
+		Version   uint32
+		PublicKey string
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Signature string
+	}{}
+	err = ssh.Unmarshal(b[len(sshSigMagic):], &blob)
+	if err != nil {
+		return err
+	}
+	if blob.Namespace != "git" || blob.HashAlg != "sha512" || blob.PublicKey != string(key.Marshal()) {
+		return fmt.Errorf("unexpected signature header: %s %s", blob.Namespace, blob.HashAlg)
+	}
+	sig := &ssh.Signature{}
+	err = ssh.Unmarshal([]byte(blob.Signature), sig)
+	if err != nil {
+		return err
+	}
+	if sig.Format == ssh.KeyAlgoRSA {
+		return fmt.Errorf("signature uses SHA-1")
+	}
+	hash := sha512.Sum512([]byte(content))
+	signedData := struct {
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Hash      string
+	}{"git", "", "sha512", string(hash[:])}
+	return key.Verify(append([]byte(sshSigMagic), ssh.Marshal(signedData)...), sig)
+}
+
+var _ = Describe("Signed commits", func() {
+	var ctx context.Context
+	var dir string
+	var localPath string
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-signing")
+		Expect(err).To(BeNil())
+		localPath = createLocalTestRepository(dir)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	// commitWithSigning creates a commit with the given signing options and returns its signature and signed content.
+	commitWithSigning := func(opts *SigningOptions) (string, string) {
+		repo, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", RepositoryOptions{Signing: opts})
+		Expect(err).To(BeNil())
+		Expect(repo.CreateBranch("promote/test", false)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(localPath, "app.yaml"), []byte("tag: v1.0.0"), 0600)).To(Succeed())
+		sha, err := repo.CreateCommit("promote/test", "promote")
+		Expect(err).To(BeNil())
+
+		branch, err := repo.gitRepository.LookupBranch("promote/test", git2go.BranchLocal)
+		Expect(err).To(BeNil())
+		Expect(branch.Target().String()).To(Equal(sha.String()))
+		commit, err := repo.gitRepository.LookupCommit(sha)
+		Expect(err).To(BeNil())
+		Expect(commit.Message()).To(Equal("promote"))
+		signature, signed, err := commit.ExtractSignature()
+		Expect(err).To(BeNil())
+		return signature, signed
+	}
+
+	It("does not sign commits by default", func() {
+		repo, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", RepositoryOptions{})
+		Expect(err).To(BeNil())
+		Expect(repo.CreateBranch("promote/test", false)).To(Succeed())
+		sha, err := repo.CreateCommit("promote/test", "promote")
+		Expect(err).To(BeNil())
+		commit, err := repo.gitRepository.LookupCommit(sha)
+		Expect(err).To(BeNil())
+		_, _, err = commit.ExtractSignature()
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("returns error with an invalid format", func() {
+		opts := &SigningOptions{Format: "x509", KeyPath: filepath.Join(dir, "key")}
+		_, err := LoadRepository(ctx, localPath, string(ProviderTypeFake), "", RepositoryOptions{Signing: opts})
+		Expect(err).To(MatchError(`invalid signing format "x509"`))
+	})
+
+	It("signs commits with a GPG key", func() {
+		entity, err := openpgp.NewEntity("gitops-promotion", "", "gitops-promotion@example.com", nil)
+		Expect(err).To(BeNil())
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+		Expect(err).To(BeNil())
+		Expect(entity.SerializePrivate(w, nil)).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+		keyPath := filepath.Join(dir, "key.asc")
+		Expect(os.WriteFile(keyPath, buf.Bytes(), 0600)).To(Succeed())
+
+		signature, signed := commitWithSigning(&SigningOptions{Format: SigningFormatGPG, KeyPath: keyPath})
+		Expect(signature).To(HavePrefix("-----BEGIN PGP SIGNATURE-----"))
+		signer, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, strings.NewReader(signed), strings.NewReader(signature))
+		Expect(err).To(BeNil())
+		Expect(signer.PrimaryKey.KeyId).To(Equal(entity.PrimaryKey.KeyId))
+	})
+
+	It("signs commits with an SSH key", func() {
+		publicKey, privateKey := sshGenerateKey()
+		keyPath := filepath.Join(dir, "id_ed25519")
+		Expect(os.WriteFile(keyPath, privateKey, 0600)).To(Succeed())
+
+		signature, signed := commitWithSigning(&SigningOptions{Format: SigningFormatSSH, KeyPath: keyPath})
+		Expect(signature).To(HavePrefix("-----BEGIN SSH SIGNATURE-----"))
+		Expect(signingVerifySSH(publicKey, signed, signature)).To(Succeed())
+		otherKey, _ := sshGenerateKey()
+		Expect(signingVerifySSH(otherKey, signed, signature)).ToNot(Succeed())
+	})
+
+	It("signs commits with an SSH RSA key using SHA-512", func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).To(BeNil())
+		publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+		Expect(err).To(BeNil())
+		keyPath := filepath.Join(dir, "id_rsa")
+		privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		Expect(os.WriteFile(keyPath, privateKey, 0600)).To(Succeed())
+
+		signature, signed := commitWithSigning(&SigningOptions{Format: SigningFormatSSH, KeyPath: keyPath})
+		Expect(signingVerifySSH(publicKey, signed, signature)).To(Succeed())
+	})
+})
@@ -0,0 +1,110 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	git2go "github.com/libgit2/git2go/v33"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultSSHPort = 22
+
+// SSHOptions configures authentication with an SSH key for git operations against SSH remotes.
+type SSHOptions struct {
+	PrivateKeyPath string
+	Passphrase     string
+	// KnownHostsPath is the known_hosts file used to verify the host key of the remote.
+	// The host key is not verified when it is empty.
+	KnownHostsPath string
+}
+
+// sshAuth holds the loaded SSH key and host key verification.
+type sshAuth struct {
+	signer          ssh.Signer
+	hostKeyCallback ssh.HostKeyCallback
+}
+
+func newSSHAuth(opts *SSHOptions) (*sshAuth, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	if opts.PrivateKeyPath == "" {
+		return nil, fmt.Errorf("SSH private key path empty")
+	}
+	signer, err := readSSHSigner(opts.PrivateKeyPath, opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+	auth := &sshAuth{signer: signer}
+	if opts.KnownHostsPath != "" {
+		auth.hostKeyCallback, err = knownhosts.New(opts.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load known hosts: %w", err)
+		}
+	}
+	return auth, nil
+}
+
+func readSSHSigner(path, passphrase string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SSH private key: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse SSH private key: %w", err)
+	}
+	return signer, nil
+}
+
+// certificateCheck verifies the host key of SSH remotes against the known hosts. Other
+// certificates are only accepted if libgit2 considers them valid.
+func (a *sshAuth) certificateCheck(remoteURL string) git2go.CertificateCheckCallback {
+	return func(cert *git2go.Certificate, valid bool, hostname string) error {
+		if cert.Kind != git2go.CertificateHostkey {
+			if !valid {
+				return fmt.Errorf("certificate for %s is not valid", hostname)
+			}
+			return nil
+		}
+		if a.hostKeyCallback == nil {
+			log.Printf("Not verifying host key for %s since no known hosts are configured\n", hostname)
+			return nil
+		}
+		if cert.Hostkey.SSHPublicKey == nil {
+			return fmt.Errorf("host key for %s is not available for verification", hostname)
+		}
+		port := sshPort(remoteURL)
+		address := net.JoinHostPort(hostname, strconv.Itoa(port))
+		remote := &net.TCPAddr{IP: net.IPv4zero, Port: port}
+		err := a.hostKeyCallback(address, remote, cert.Hostkey.SSHPublicKey)
+		if err != nil {
+			return fmt.Errorf("could not verify host key for %s: %w", hostname, err)
+		}
+		return nil
+	}
+}
+
+// sshPort returns the port of an ssh:// remote URL, scp-like addresses always use the default port.
+func sshPort(remoteURL string) int {
+	u, err := url.Parse(remoteURL)
+	if err != nil || u.Port() == "" {
+		return defaultSSHPort
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return defaultSSHPort
+	}
+	return port
+}
@@ -0,0 +1,129 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	git2go "github.com/libgit2/git2go/v33"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func sshGenerateKey() (ssh.PublicKey, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).To(BeNil())
+	sshPub, err := ssh.NewPublicKey(pub)
+	Expect(err).To(BeNil())
+	b, err := x509.MarshalPKCS8PrivateKey(priv)
+	Expect(err).To(BeNil())
+	return sshPub, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b})
+}
+
+var _ = Describe("SSH authentication", func() {
+	var dir string
+	var opts *SSHOptions
+	var hostKey ssh.PublicKey
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "gitops-promotion-ssh")
+		Expect(err).To(BeNil())
+		_, privateKey := sshGenerateKey()
+		opts = &SSHOptions{PrivateKeyPath: filepath.Join(dir, "id_ed25519")}
+		Expect(os.WriteFile(opts.PrivateKeyPath, privateKey, 0600)).To(Succeed())
+
+		hostKey, _ = sshGenerateKey()
+		knownHosts := knownhosts.Line([]string{"example.com", "[example.com]:7999"}, hostKey) + "\n"
+		Expect(os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(knownHosts), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	hostKeyCert := func(key ssh.PublicKey) *git2go.Certificate {
+		return &git2go.Certificate{
+			Kind:    git2go.CertificateHostkey,
+			Hostkey: git2go.HostkeyCertificate{Kind: git2go.HostkeyRaw, SSHPublicKey: key},
+		}
+	}
+
+	It("is disabled without options", func() {
+		auth, err := newSSHAuth(nil)
+		Expect(err).To(BeNil())
+		Expect(auth).To(BeNil())
+	})
+
+	It("returns error when the private key can not be read", func() {
+		opts.PrivateKeyPath = filepath.Join(dir, "missing")
+		_, err := newSSHAuth(opts)
+		Expect(err).To(MatchError(ContainSubstring("could not read SSH private key")))
+	})
+
+	It("returns error when the private key is invalid", func() {
+		Expect(os.WriteFile(opts.PrivateKeyPath, []byte("foo"), 0600)).To(Succeed())
+		_, err := newSSHAuth(opts)
+		Expect(err).To(MatchError(ContainSubstring("could not parse SSH private key")))
+	})
+
+	It("returns error when the known hosts can not be read", func() {
+		opts.KnownHostsPath = filepath.Join(dir, "missing")
+		_, err := newSSHAuth(opts)
+		Expect(err).To(MatchError(ContainSubstring("could not load known hosts")))
+	})
+
+	It("uses the SSH key only when the remote allows it", func() {
+		auth, err := newSSHAuth(opts)
+		Expect(err).To(BeNil())
+		callbacks := credentialsCallback("git@example.com:org/repo.git", "git", "token", auth)
+
+		cred, err := callbacks.CredentialsCallback("git@example.com:org/repo.git", "git", git2go.CredentialTypeSSHCustom|git2go.CredentialTypeSSHKey)
+		Expect(err).To(BeNil())
+		Expect(cred.Type()).To(Equal(git2go.CredentialTypeSSHCustom))
+
+		cred, err = callbacks.CredentialsCallback("https://example.com/org/repo.git", "", git2go.CredentialTypeUserpassPlaintext)
+		Expect(err).To(BeNil())
+		Expect(cred.Type()).To(Equal(git2go.CredentialTypeUserpassPlaintext))
+	})
+
+	It("accepts any host key without known hosts", func() {
+		auth, err := newSSHAuth(opts)
+		Expect(err).To(BeNil())
+		otherKey, _ := sshGenerateKey()
+		err = auth.certificateCheck("git@example.com:org/repo.git")(hostKeyCert(otherKey), false, "example.com")
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies the host key against the known hosts", func() {
+		opts.KnownHostsPath = filepath.Join(dir, "known_hosts")
+		auth, err := newSSHAuth(opts)
+		Expect(err).To(BeNil())
+		otherKey, _ := sshGenerateKey()
+
+		check := auth.certificateCheck("git@example.com:org/repo.git")
+		Expect(check(hostKeyCert(hostKey), false, "example.com")).To(Succeed())
+		Expect(check(hostKeyCert(otherKey), false, "example.com")).To(MatchError(ContainSubstring("could not verify host key for example.com")))
+		Expect(check(hostKeyCert(hostKey), false, "example.org")).To(MatchError(ContainSubstring("could not verify host key for example.org")))
+		Expect(check(hostKeyCert(nil), false, "example.com")).To(MatchError("host key for example.com is not available for verification"))
+
+		check = auth.certificateCheck("ssh://git@example.com:7999/org/repo.git")
+		Expect(check(hostKeyCert(hostKey), false, "example.com")).To(Succeed())
+		check = auth.certificateCheck("ssh://git@example.com:2222/org/repo.git")
+		Expect(check(hostKeyCert(hostKey), false, "example.com")).ToNot(Succeed())
+	})
+
+	It("only accepts valid certificates for other transports", func() {
+		auth, err := newSSHAuth(opts)
+		Expect(err).To(BeNil())
+		check := auth.certificateCheck("https://example.com/org/repo.git")
+		cert := &git2go.Certificate{Kind: git2go.CertificateX509}
+		Expect(check(cert, true, "example.com")).To(Succeed())
+		Expect(check(cert, false, "example.com")).To(MatchError("certificate for example.com is not valid"))
+	})
+})
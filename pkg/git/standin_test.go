@@ -0,0 +1,89 @@
+package git
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// standInHandler handles a request to a stand-in for a provider API. The params are the path
+// segments matched by the wildcards of the route.
+type standInHandler func(w http.ResponseWriter, r *http.Request, params []string)
+
+type standInRoute struct {
+	method  string
+	pattern []string
+	handler standInHandler
+}
+
+// standInRouter routes requests to the handlers of a stand-in by method and escaped path. A *
+// segment in a path pattern matches any segment. Requests are served one at a time, so handlers
+// can change the state of the stand-in without locking. Unknown routes are not found.
+type standInRouter struct {
+	mu     sync.Mutex
+	routes []standInRoute
+}
+
+func (rt *standInRouter) handle(method, pattern string, handler standInHandler) {
+	rt.routes = append(rt.routes, standInRoute{method: method, pattern: strings.Split(pattern, "/"), handler: handler})
+}
+
+func (rt *standInRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	path := strings.Split(r.URL.EscapedPath(), "/")
+	for _, route := range rt.routes {
+		if params, ok := route.match(r.Method, path); ok {
+			route.handler(w, r, params)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (route standInRoute) match(method string, path []string) ([]string, bool) {
+	if method != route.method || len(path) != len(route.pattern) {
+		return nil, false
+	}
+	params := []string{}
+	for i, segment := range route.pattern {
+		switch segment {
+		case "*":
+			params = append(params, path[i])
+		case path[i]:
+		default:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// standInLookup returns the index of the item with the one-based id in a list of n items. The
+// request is answered with not found and -1 is returned if there is no such item.
+func standInLookup(w http.ResponseWriter, r *http.Request, id string, n int) int {
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 1 || i > n {
+		http.NotFound(w, r)
+		return -1
+	}
+	return i - 1
+}
+
+// readJSON decodes the body of the request into v. Requests without a body leave v unchanged.
+func readJSON(r *http.Request, v interface{}) {
+	if r.Body == nil {
+		return
+	}
+	//nolint:errcheck // empty bodies are expected for some requests
+	_ = json.NewDecoder(r.Body).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck // best effort in test server
+	_ = json.NewEncoder(w).Encode(v)
+}
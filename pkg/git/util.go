@@ -14,13 +14,16 @@ func ParseGitAddress(s string) (host string, id string, err error) {
 		return "", "", err
 	}
 
+	// The port of an ssh address is the ssh port, which is never the port of the API.
 	scheme := u.Scheme
+	hostname := u.Host
 	if u.Scheme == "ssh" {
 		scheme = "https"
+		hostname = u.Hostname()
 	}
 
 	id = strings.TrimLeft(u.Path, "/")
 	id = strings.TrimSuffix(id, ".git")
-	host = fmt.Sprintf("%s://%s", scheme, u.Host)
+	host = fmt.Sprintf("%s://%s", scheme, hostname)
 	return host, id, nil
 }
@@ -37,6 +37,30 @@ func TestParseGitAddress(t *testing.T) {
 			expectedID:    "organization/project/_git/repository",
 			expectedError: "",
 		},
+		{
+			input:         "ssh://git@bitbucket.example.com:7999/project/repository.git",
+			expectedHost:  "https://bitbucket.example.com",
+			expectedID:    "project/repository",
+			expectedError: "",
+		},
+		{
+			input:         "https://github.com/scm/repo",
+			expectedHost:  "https://github.com",
+			expectedID:    "scm/repo",
+			expectedError: "",
+		},
+		{
+			input:         "https://gitlab.example.com/group/scm/repo.git",
+			expectedHost:  "https://gitlab.example.com",
+			expectedID:    "group/scm/repo",
+			expectedError: "",
+		},
+		{
+			input:         "git@github.com:scm/tools.git",
+			expectedHost:  "https://github.com",
+			expectedID:    "scm/tools",
+			expectedError: "",
+		},
 		{
 			input:         "/tmp/organization/project/_git/repository.git",
 			expectedHost:  "file://",
@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/xenitab/gitops-promotion/pkg/git"
+)
+
+// UpdateHelmRelease changes the image tag of the application at valuesPath in the values of the
+// Flux HelmRelease called name in the manifests of the environment. Maps on the path are created
+// if they are missing. It assumes that the fs is a base fs in the repository directory.
+func UpdateHelmRelease(fs afero.Fs, state git.PRState, name string, valuesPath []string) error {
+	ref := imageRef(state)
+	dir := state.EnvPath()
+	path := append([]string{"spec", "values"}, valuesPath...)
+	log.Printf("Updating %s of HelmRelease %s to %s in %s\n", strings.Join(valuesPath, "."), name, ref, dir)
+	result, err := updateFiles(fs, dir, "HelmRelease", func(nodes []*yaml.RNode) (bool, bool, error) {
+		matched, changed := false, false
+		for _, node := range nodes {
+			if node.GetKind() != "HelmRelease" || node.GetName() != name {
+				continue
+			}
+			matched = true
+			nodeChanged, err := setValue(node, path, ref)
+			if err != nil {
+				return false, false, fmt.Errorf("HelmRelease %s: %w", name, err)
+			}
+			changed = changed || nodeChanged
+		}
+		return matched, changed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating manifests: %w", err)
+	}
+	if result.matched == 0 {
+		return fmt.Errorf("%w: no HelmRelease %s in %s", ErrNoImageUpdated, name, dir)
+	}
+	if result.changed == 0 {
+		return fmt.Errorf("%w: image of HelmRelease %s in %s is already set to %s", ErrNoImageUpdated, name, dir, ref)
+	}
+	return nil
+}
+
+// UpdateHelmValuesFile changes the image tag of the application at valuesPath in the Helm values
+// file, relative to the environment directory. This is used when the values of a HelmRelease are
+// read from a ConfigMap or Secret generated from the file.
+func UpdateHelmValuesFile(fs afero.Fs, state git.PRState, file string, valuesPath []string) error {
+	ref := imageRef(state)
+	path := filepath.Join(state.EnvPath(), file)
+	log.Printf("Updating %s to %s in %s\n", strings.Join(valuesPath, "."), ref, path)
+	info, err := fs.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed reading values file: %w", err)
+	}
+	_, changed, err := updateFile(fs, path, info.Mode(), "", func(nodes []*yaml.RNode) (bool, bool, error) {
+		if len(nodes) != 1 {
+			return false, false, fmt.Errorf("values file has to contain exactly one document")
+		}
+		changed, err := setValue(nodes[0], valuesPath, ref)
+		return true, changed, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating values file %s: %w", path, err)
+	}
+	if !changed {
+		return fmt.Errorf("%w: %s in %s is already set to %s", ErrNoImageUpdated, strings.Join(valuesPath, "."), path, ref)
+	}
+	return nil
+}
+
+// setValue sets the scalar at path in the node to the value, creating the maps on the path if they
+// are missing, and returns true if the value changed.
+func setValue(node *yaml.RNode, path []string, value string) (bool, error) {
+	field, err := node.Pipe(yaml.LookupCreate(yaml.ScalarNode, path...))
+	if err != nil {
+		return false, fmt.Errorf("could not look up %s: %w", strings.Join(path, "."), err)
+	}
+	if field.YNode().Kind != yaml.ScalarNode {
+		return false, fmt.Errorf("%s is not a scalar value", strings.Join(path, "."))
+	}
+	return setScalar(field.YNode(), value), nil
+}
@@ -0,0 +1,175 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xenitab/gitops-promotion/pkg/git"
+)
+
+const helmReleaseData = `apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+  values:
+    replicaCount: 2
+    image:
+      tag: 6.0.0
+---
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: redis
+spec:
+  values:
+    image:
+      tag: 6.2.0
+`
+
+func TestUpdateHelmRelease(t *testing.T) {
+	cases := []struct {
+		name                string
+		state               git.PRState
+		release             string
+		valuesPath          []string
+		after               string
+		expectedErrContains string
+	}{
+		{
+			name:       "existing tag",
+			state:      git.PRState{Env: "dev", Group: "apps", App: "podinfo", Tag: "6.0.1"},
+			release:    "podinfo",
+			valuesPath: []string{"image", "tag"},
+			after: `apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+  values:
+    replicaCount: 2
+    image:
+      tag: 6.0.1
+---
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: redis
+spec:
+  values:
+    image:
+      tag: 6.2.0
+`,
+		},
+		{
+			name:       "missing path with digest",
+			state:      git.PRState{Env: "dev", Group: "apps", App: "redis", Tag: "6.2.1", Digest: "sha256:abc"},
+			release:    "redis",
+			valuesPath: []string{"redis", "image", "tag"},
+			after: `apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+spec:
+  chart:
+    spec:
+      chart: podinfo
+  values:
+    replicaCount: 2
+    image:
+      tag: 6.0.0
+---
+apiVersion: helm.toolkit.fluxcd.io/v2beta1
+kind: HelmRelease
+metadata:
+  name: redis
+spec:
+  values:
+    image:
+      tag: 6.2.0
+    redis:
+      image:
+        tag: 6.2.1@sha256:abc
+`,
+		},
+		{
+			name:                "unknown release",
+			state:               git.PRState{Env: "dev", Group: "apps", App: "podinfo", Tag: "6.0.1"},
+			release:             "frontend",
+			valuesPath:          []string{"image", "tag"},
+			expectedErrContains: "no image was updated: no HelmRelease frontend in apps/dev",
+		},
+		{
+			name:                "already set",
+			state:               git.PRState{Env: "dev", Group: "apps", App: "podinfo", Tag: "6.0.0"},
+			release:             "podinfo",
+			valuesPath:          []string{"image", "tag"},
+			expectedErrContains: "no image was updated: image of HelmRelease podinfo in apps/dev is already set to 6.0.0",
+		},
+		{
+			name:                "not a scalar",
+			state:               git.PRState{Env: "dev", Group: "apps", App: "podinfo", Tag: "6.0.1"},
+			release:             "podinfo",
+			valuesPath:          []string{"image"},
+			expectedErrContains: "HelmRelease podinfo: spec.values.image is not a scalar value",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fs, "apps/dev/releases.yaml", []byte(helmReleaseData), 0600))
+
+			err := UpdateHelmRelease(fs, c.state, c.release, c.valuesPath)
+			if c.expectedErrContains != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.expectedErrContains)
+				return
+			}
+			require.NoError(t, err)
+			testFileContains(t, fs, "apps/dev/releases.yaml", c.after)
+		})
+	}
+}
+
+func TestUpdateHelmValuesFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	values := `# Values of podinfo in dev
+replicaCount: 2
+image:
+  repository: ghcr.io/stefanprodan/podinfo
+  tag: 6.0.0 # the current release
+`
+	require.NoError(t, afero.WriteFile(fs, "apps/dev/values/podinfo.yaml", []byte(values), 0600))
+	state := git.PRState{Env: "dev", Group: "apps", App: "podinfo", Tag: "1234"}
+
+	err := UpdateHelmValuesFile(fs, state, "values/podinfo.yaml", []string{"image", "tag"})
+	require.NoError(t, err)
+	testFileContains(t, fs, "apps/dev/values/podinfo.yaml", `# Values of podinfo in dev
+replicaCount: 2
+image:
+  repository: ghcr.io/stefanprodan/podinfo
+  tag: "1234" # the current release
+`)
+
+	err = UpdateHelmValuesFile(fs, state, "values/podinfo.yaml", []string{"image", "tag"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no image was updated: image.tag in apps/dev/values/podinfo.yaml is already set to 1234")
+
+	require.NoError(t, afero.WriteFile(fs, "apps/dev/values/invalid.yaml", []byte("image:\n  tag: [1, 2\n"), 0600))
+	err = UpdateHelmValuesFile(fs, state, "values/invalid.yaml", []string{"image", "tag"})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrNoImageUpdated)
+	require.Contains(t, err.Error(), "failed updating values file apps/dev/values/invalid.yaml: file could not be parsed")
+
+	err = UpdateHelmValuesFile(fs, state, "values/missing.yaml", []string{"image", "tag"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed reading values file")
+}
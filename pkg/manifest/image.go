@@ -1,33 +1,206 @@
 package manifest
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fluxcd/image-automation-controller/pkg/update"
-	imagev1_reflect "github.com/fluxcd/image-reflector-controller/api/v1beta1"
-	"github.com/go-logr/logr"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/spf13/afero"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/xenitab/gitops-promotion/pkg/git"
 )
 
-// UpdateImageTag changes the image tag in the kustomization file.
-// TODO: Should change to using fs objects.
-func UpdateImageTag(path, app, group, tag string) error {
-	policies := []imagev1_reflect.ImagePolicy{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      app,
-				Namespace: group,
-			},
-			Status: imagev1_reflect.ImagePolicyStatus{
-				LatestImage: fmt.Sprintf("%s:%s", app, tag),
-			},
-		},
-	}
-	log.Printf("Updating images with %s:%s:%s in %s\n", group, app, tag, path)
-	_, err := update.UpdateWithSetters(logr.Discard(), path, path, policies)
+// ErrNoImageUpdated is returned when no image was changed, either because no field to update was
+// found for the application or because they are already set.
+var ErrNoImageUpdated = errors.New("no image was updated")
+
+// UpdateImageTag changes the image tag of the application in the manifests of the environment.
+// The image is pinned to the digest as tag@digest when the digest is set. It assumes that the fs
+// is a base fs in the repository directory.
+func UpdateImageTag(fs afero.Fs, state git.PRState) error {
+	ref := imageRef(state)
+	// The setters are the same as the ones of the Flux image automation controller
+	setter := fmt.Sprintf("%s:%s", state.Group, state.App)
+	values := map[string]string{
+		setter:           fmt.Sprintf("%s:%s", state.App, ref),
+		setter + ":tag":  ref,
+		setter + ":name": state.App,
+	}
+	dir := state.EnvPath()
+	log.Printf("Updating images with %s:%s:%s in %s\n", state.Group, state.App, ref, dir)
+	marker := fmt.Sprintf("%q", update.SetterShortHand)
+	result, err := updateFiles(fs, dir, marker, func(nodes []*yaml.RNode) (bool, bool, error) {
+		matched, changed := updateWithSetters(nodes, values)
+		return matched, changed, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed updating manifests: %w", err)
 	}
+	if result.matched == 0 {
+		return fmt.Errorf("%w: no field in %s is marked with an image policy of group %s and app %s",
+			ErrNoImageUpdated, dir, state.Group, state.App)
+	}
+	if result.changed == 0 {
+		return fmt.Errorf("%w: images of %s/%s in %s are already set to %s", ErrNoImageUpdated, state.Group, state.App, dir, ref)
+	}
 	return nil
 }
+
+// imageRef returns the tag of the state, pinned to the digest as tag@digest when it is set.
+func imageRef(state git.PRState) string {
+	if state.Digest != "" {
+		return fmt.Sprintf("%s@%s", state.Tag, state.Digest)
+	}
+	return state.Tag
+}
+
+// updateResult is the number of files with fields to update, and the number of files where the
+// value of a field was changed.
+type updateResult struct {
+	matched int
+	changed int
+}
+
+// updateFn updates the documents of a file, and returns if any field to update was found and if
+// any field was changed.
+type updateFn func(nodes []*yaml.RNode) (bool, bool, error)
+
+// updateFiles updates the YAML files in dir that contain the marker, and writes back the files that
+// were changed.
+func updateFiles(fs afero.Fs, dir, marker string, fn updateFn) (updateResult, error) {
+	result := updateResult{}
+	err := afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		matched, changed, err := updateFile(fs, path, info.Mode(), marker, fn)
+		if errors.Is(err, errInvalidYAML) {
+			log.Printf("Skipping %s: %v\n", path, err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not update %s: %w", path, err)
+		}
+		if matched {
+			result.matched++
+		}
+		if changed {
+			result.changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return updateResult{}, err
+	}
+	return result, nil
+}
+
+// errInvalidYAML is returned by updateFile when the file can not be parsed.
+var errInvalidYAML = errors.New("file could not be parsed")
+
+// updateFile updates the documents in the file, and returns if any field to update was found and
+// if the file was changed. Only files containing the marker are parsed, and updateFiles skips files
+// which are not valid YAML, like Helm chart templates.
+func updateFile(fs afero.Fs, path string, mode os.FileMode, marker string, fn updateFn) (bool, bool, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return false, false, err
+	}
+	if !bytes.Contains(b, []byte(marker)) {
+		return false, false, nil
+	}
+	nodes, err := (&kio.ByteReader{Reader: bytes.NewReader(b), PreserveSeqIndent: true}).Read()
+	if err != nil {
+		return false, false, fmt.Errorf("%w: %v", errInvalidYAML, err)
+	}
+	matched, changed, err := fn(nodes)
+	if err != nil || !changed {
+		return matched, false, err
+	}
+	var buf bytes.Buffer
+	err = kio.ByteWriter{Writer: &buf}.Write(nodes)
+	if err != nil {
+		return false, false, err
+	}
+	return true, true, afero.WriteFile(fs, path, buf.Bytes(), mode)
+}
+
+// updateWithSetters sets the fields marked with the setters to the values of the setters. The Flux
+// image automation controller is not used directly as it parses the values from an image reference,
+// which can not represent a tag pinned to a digest in the tag setter, and only works on the OS file
+// system.
+func updateWithSetters(nodes []*yaml.RNode, values map[string]string) (bool, bool) {
+	matched, changed := false, false
+	for _, node := range nodes {
+		walkScalars(node.YNode(), func(field *yaml.Node) {
+			value, ok := values[setterName(field)]
+			if !ok {
+				return
+			}
+			matched = true
+			if setScalar(field, value) {
+				changed = true
+			}
+		})
+	}
+	return matched, changed
+}
+
+// walkScalars calls fn with every scalar value in the node, map keys are skipped.
+func walkScalars(node *yaml.Node, fn func(*yaml.Node)) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		fn(node)
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			walkScalars(node.Content[i], fn)
+		}
+	default:
+		for _, child := range node.Content {
+			walkScalars(child, fn)
+		}
+	}
+}
+
+// setterName returns the name of the setter that the field is marked with, e.g. team1:app1:tag for
+// a comment like {"$imagepolicy": "team1:app1:tag"}, or an empty string if it is not marked.
+func setterName(field *yaml.Node) string {
+	for _, comment := range []string{field.LineComment, field.HeadComment} {
+		marker := map[string]string{}
+		err := json.Unmarshal([]byte(strings.TrimLeft(comment, "# ")), &marker)
+		if err == nil && marker[update.SetterShortHand] != "" {
+			return marker[update.SetterShortHand]
+		}
+	}
+	return ""
+}
+
+// setScalar sets the value of the field and returns true if the field changed. The field is always
+// a string, so it is quoted if a YAML 1.1 parser would read the value as another type, like a
+// build number tag 1234 or true. Quotes that are already there are kept.
+func setScalar(field *yaml.Node, value string) bool {
+	if field.Value == value && field.Tag == yaml.NodeTagString {
+		return false
+	}
+	field.Value = value
+	field.Tag = yaml.NodeTagString
+	quoted := field.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0
+	if !quoted && yaml.IsValueNonString(value) {
+		field.Style = yaml.DoubleQuotedStyle
+	}
+	return true
+}
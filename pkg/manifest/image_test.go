@@ -2,10 +2,12 @@ package manifest
 
 import (
 	"fmt"
-	"os"
-	"strings"
+	"path/filepath"
 	"testing"
 
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+
 	"github.com/xenitab/gitops-promotion/pkg/git"
 )
 
@@ -15,7 +17,6 @@ func TestUpdateImageTag(t *testing.T) {
 		before              string
 		after               string
 		expectedErrContains string
-		expectedMatch       bool
 	}{
 		{
 			state: git.PRState{
@@ -33,7 +34,6 @@ image: app1:v1.0.1 # {"$imagepolicy": "team1:app1"}
 why: true
 `,
 			expectedErrContains: "",
-			expectedMatch:       true,
 		},
 		{
 			state: git.PRState{
@@ -51,7 +51,52 @@ tag: v1.0.1 # {"$imagepolicy": "team1:app1:tag"}
 why: true
 `,
 			expectedErrContains: "",
-			expectedMatch:       true,
+		},
+		{
+			state: git.PRState{
+				Env:    "dev",
+				Group:  "team1",
+				App:    "app1",
+				Tag:    "v1.0.1",
+				Digest: "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7",
+			},
+			before: `random: test
+image: app1:v1.0.0 # {"$imagepolicy": "team1:app1"}
+name: app1 # {"$imagepolicy": "team1:app1:name"}
+tag: v1.0.0 # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			after: `random: test
+image: app1:v1.0.1@sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7 # {"$imagepolicy": "team1:app1"}
+name: app1 # {"$imagepolicy": "team1:app1:name"}
+tag: v1.0.1@sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7 # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			expectedErrContains: "",
+		},
+		{
+			state: git.PRState{
+				Env:   "dev",
+				Group: "team1",
+				App:   "app2",
+				Tag:   "v1.0.1",
+			},
+			before: `random: test
+image: app1:v1.0.0 # {"$imagepolicy": "team1:app1"}
+`,
+			expectedErrContains: "no image was updated: no field in",
+		},
+		{
+			state: git.PRState{
+				Env:   "dev",
+				Group: "team1",
+				App:   "app1",
+				Tag:   "v1.0.1",
+			},
+			before: `random: test
+image: app1:v1.0.1 # {"$imagepolicy": "team1:app1"}
+`,
+			expectedErrContains: "images of team1/app1 in",
 		},
 		{
 			state: git.PRState{
@@ -69,7 +114,6 @@ tag: "v1.0.1" # {"$imagepolicy": "team1:app1:tag"}
 why: true
 `,
 			expectedErrContains: "",
-			expectedMatch:       true,
 		},
 		{
 			state: git.PRState{
@@ -87,44 +131,97 @@ tag: v1.0.1 # {"$imagepolicy": "team1:app1:tag"}
 why: true
 `,
 			expectedErrContains: "",
-			expectedMatch:       false, // This is a know issue: https://github.com/XenitAB/gitops-promotion/issues/32
+		},
+		{
+			state: git.PRState{
+				Env:   "dev",
+				Group: "team1",
+				App:   "app1",
+				Tag:   "5678",
+			},
+			before: `random: test
+tag: 1234 # {"$imagepolicy": "team1:app1:tag"}
+image: app1:1234 # {"$imagepolicy": "team1:app1"}
+why: true
+`,
+			after: `random: test
+tag: "5678" # {"$imagepolicy": "team1:app1:tag"}
+image: app1:5678 # {"$imagepolicy": "team1:app1"}
+why: true
+`,
+			expectedErrContains: "",
+		},
+		{
+			state: git.PRState{
+				Env:   "dev",
+				Group: "team1",
+				App:   "app1",
+				Tag:   "1.10",
+			},
+			before: `random: test
+tag: 'v1' # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			after: `random: test
+tag: '1.10' # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			expectedErrContains: "",
+		},
+		{
+			state: git.PRState{
+				Env:   "dev",
+				Group: "team1",
+				App:   "app1",
+				Tag:   "yes",
+			},
+			before: `random: test
+tag: v1 # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			after: `random: test
+tag: "yes" # {"$imagepolicy": "team1:app1:tag"}
+why: true
+`,
+			expectedErrContains: "",
 		},
 	}
 
-	for i, c := range cases {
-		dir, err := os.MkdirTemp("", fmt.Sprintf("%d", i))
-		if err != nil && c.expectedErrContains == "" {
-			t.Errorf("Expected err to be nil: %q", err)
-		}
-
-		defer os.RemoveAll(dir)
-
-		testFile := fmt.Sprintf("%s/%s.yaml", dir, c.state.App)
-		err = os.WriteFile(testFile, []byte(c.before), 0600)
-		if err != nil && c.expectedErrContains == "" {
-			t.Errorf("Expected err to be nil: %q", err)
-		}
-
-		err = UpdateImageTag(dir, c.state.App, c.state.Group, c.state.Tag)
-		if err == nil && c.expectedErrContains != "" {
-			t.Errorf("Expected err not to be nil")
-		}
+	for _, c := range cases {
+		fs := afero.NewMemMapFs()
+		testFile := filepath.Join(c.state.EnvPath(), fmt.Sprintf("%s.yaml", c.state.App))
+		err := afero.WriteFile(fs, testFile, []byte(c.before), 0600)
+		require.NoError(t, err)
 
-		if err != nil && c.expectedErrContains != "" {
-			if !strings.Contains(err.Error(), c.expectedErrContains) {
-				t.Errorf("Expected err to contain '%q' but received: %q", c.expectedErrContains, err.Error())
-			}
+		err = UpdateImageTag(fs, c.state)
+		if c.expectedErrContains != "" {
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.expectedErrContains)
+			continue
 		}
+		require.NoError(t, err)
+		testFileContains(t, fs, testFile, c.after)
+	}
+}
 
-		if err == nil && c.expectedErrContains == "" {
-			result, err := os.ReadFile(testFile)
-			if err != nil && c.expectedErrContains == "" {
-				t.Errorf("Expected err to be nil: %q", err)
-			}
-
-			if string(result) != c.after && c.expectedMatch {
-				t.Errorf("\nExpected:\n%s\n\nReceived:\n%s\n", c.after, string(result))
-			}
-		}
+func TestUpdateImageTagFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"apps/dev/app1.yaml":           "image: app1:v1.0.0 # {\"$imagepolicy\": \"apps:app1\"}\n",
+		"apps/dev/nested/app1.yml":     "tag: v1.0.0 # {\"$imagepolicy\": \"apps:app1:tag\"}\n",
+		"apps/dev/chart/template.yaml": "image: {{ .Values.image }} # {\"$imagepolicy\": \"apps:app1\"}\n",
+		"apps/dev/notes.txt":           "image: app1:v1.0.0 # {\"$imagepolicy\": \"apps:app1\"}\n",
+		"apps/qa/app1.yaml":            "image: app1:v1.0.0 # {\"$imagepolicy\": \"apps:app1\"}\n",
 	}
+	for path, content := range files {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(content), 0600))
+	}
+
+	err := UpdateImageTag(fs, git.PRState{Group: "apps", App: "app1", Env: "dev", Tag: "v1.0.1"})
+	require.NoError(t, err)
+	testFileContains(t, fs, "apps/dev/app1.yaml", "image: app1:v1.0.1 # {\"$imagepolicy\": \"apps:app1\"}\n")
+	testFileContains(t, fs, "apps/dev/nested/app1.yml", "tag: v1.0.1 # {\"$imagepolicy\": \"apps:app1:tag\"}\n")
+	testFileContains(t, fs, "apps/dev/chart/template.yaml", files["apps/dev/chart/template.yaml"])
+	testFileContains(t, fs, "apps/dev/notes.txt", files["apps/dev/notes.txt"])
+	testFileContains(t, fs, "apps/qa/app1.yaml", files["apps/qa/app1.yaml"])
 }
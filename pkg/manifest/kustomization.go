@@ -10,6 +10,7 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/kustomize/api/image"
+	"sigs.k8s.io/kustomize/api/konfig"
 	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/resource"
 	kustypes "sigs.k8s.io/kustomize/api/types"
@@ -135,6 +136,31 @@ func RemoveApplication(fs afero.Fs, state git.PRState) error {
 	return nil
 }
 
+// ValidateKustomization checks that there is a kustomization file in the directory and that it can be parsed.
+func ValidateKustomization(fs afero.Fs, dir string) error {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		path := filepath.Join(dir, name)
+		exists, err := afero.Exists(fs, path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		b, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		kustomization := &kustypes.Kustomization{}
+		err = kustomization.Unmarshal(b)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("could not find a kustomization file in %s", dir)
+}
+
 func manfifestsMatchingSelector(fs afero.Fs, path string, labelSelector map[string]string) ([]*resource.Resource, error) {
 	selector, err := labels.ValidatedSelectorFromSet(labelSelector)
 	if err != nil {
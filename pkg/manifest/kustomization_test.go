@@ -77,6 +77,22 @@ images:
 	require.EqualError(t, err, "stat testdata/duplicate-application/apps/dev/nginx-feature: no such file or directory")
 }
 
+func TestValidateKustomization(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "apps/dev/kustomization.yaml", []byte("resources:\n- ../base\n"), 0600))
+	require.NoError(t, afero.WriteFile(fs, "apps/qa/Kustomization", []byte("resources:\n- ../base\n"), 0600))
+	require.NoError(t, afero.WriteFile(fs, "apps/prod/kustomization.yaml", []byte("resource:\n- ../base\n"), 0600))
+	require.NoError(t, fs.MkdirAll("apps/staging", 0755))
+
+	require.NoError(t, ValidateKustomization(fs, "apps/dev"))
+	require.NoError(t, ValidateKustomization(fs, "apps/qa"))
+	err := ValidateKustomization(fs, "apps/prod")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not parse apps/prod/kustomization.yaml")
+	require.Contains(t, err.Error(), `unknown field "resource"`)
+	require.EqualError(t, ValidateKustomization(fs, "apps/staging"), "could not find a kustomization file in apps/staging")
+}
+
 func TestPatchIngress(t *testing.T) {
 	yamlTemplate := `apiVersion: networking.k8s.io/v1
 kind: Ingress
@@ -45,6 +45,20 @@ var providers = []providerConfig{
 		url:           os.Getenv("GITHUB_URL"),
 		defaultBranch: "main",
 	},
+	// The url of the fake provider is set to a local bare repository when the test is run.
+	{
+		providerType:  git.ProviderTypeFake,
+		username:      "gitops-promotion",
+		password:      "fake",
+		defaultBranch: "main",
+	},
+	// The default branch is detected from the remote, so a different one should work as well.
+	{
+		providerType:  git.ProviderTypeFake,
+		username:      "gitops-promotion",
+		password:      "fake",
+		defaultBranch: "master",
+	},
 }
 
 //nolint:gocritic // Using reference will trigger warning that p is a loop variable below
@@ -125,13 +139,28 @@ func testRunCommand(t *testing.T, path string, verb string, args ...string) (str
 
 func TestProviderE2E(t *testing.T) {
 	for _, p := range providers {
-		ctx := context.Background()
-		err := testSetup(ctx, p)
-		require.NoError(t, err)
-		t.Run(string(p.providerType), func(t *testing.T) {
+		name := string(p.providerType)
+		if p.defaultBranch != git.DefaultBranch {
+			name = fmt.Sprintf("%s-%s", name, p.defaultBranch)
+		}
+		t.Run(name, func(t *testing.T) {
+			if p.providerType == git.ProviderTypeFake {
+				if os.Getenv("GITOPS_PROMOTION_IMAGE") != "" {
+					t.Skipf("Skipping test since the fake provider remote is not available in the container")
+				}
+				p.url = testCreateRemoteRepository(t, p.defaultBranch)
+			}
 			if p.url == "" || p.password == "" {
 				t.Skipf("Skipping test since url or password env var is not set")
 			}
+			ctx := context.Background()
+			err := testSetup(ctx, p)
+			require.NoError(t, err)
+			defer func() {
+				err := testTeardown(ctx, p)
+				require.NoError(t, err)
+			}()
+
 			path := t.TempDir()
 			testCloneRepository(t, p.url, p.username, p.password, path, p.defaultBranch)
 
@@ -140,8 +169,6 @@ func TestProviderE2E(t *testing.T) {
 			group := "testgroup"
 			app := "testapp"
 
-			ctx := context.Background()
-
 			// Test DEV
 			newCommandMsgDev, err := testRunCommand(
 				t,
@@ -192,8 +219,14 @@ func TestProviderE2E(t *testing.T) {
 
 			repoQa := testGetRepository(t, path)
 			revQa := testGetRepositoryHeadRevision(t, repoQa)
+			commitQa := testGetRepositoryHeadCommit(t, repoQa)
+			// Only the fake provider remote is seeded with the config from testdata that sets the commit templates
+			if p.providerType == git.ProviderTypeFake {
+				require.Equal(t, "chore(testgroup): promote testapp to qa", commitQa.Message())
+				require.Equal(t, "gitops-promotion-e2e@example.com", commitQa.Author().Email)
+			}
 
-			testMergePR(t, ctx, p.providerType, p.url, p.password, promoteBranchName, revQa)
+			testMergePR(t, ctx, p.providerType, p.url, p.password, promoteBranchName, p.defaultBranch, revQa)
 
 			path = testCloneRepositoryAndValidateTag(t, p.url, p.username, p.password, p.defaultBranch, group, "qa", app, tag)
 
@@ -230,7 +263,7 @@ func TestProviderE2E(t *testing.T) {
 			repoProd := testGetRepository(t, path)
 			revProd := testGetRepositoryHeadRevision(t, repoProd)
 
-			testMergePR(t, ctx, p.providerType, p.url, p.password, promoteBranchName, revProd)
+			testMergePR(t, ctx, p.providerType, p.url, p.password, promoteBranchName, p.defaultBranch, revProd)
 
 			path = testCloneRepositoryAndValidateTag(t, p.url, p.username, p.password, p.defaultBranch, group, "prod", app, tag)
 
@@ -257,7 +290,5 @@ func TestProviderE2E(t *testing.T) {
 			featureBranchName := fmt.Sprintf("feature/%s-%s-%s", group, app, feature)
 			require.Contains(t, featureCommandMsg, fmt.Sprintf("created branch %s with pull request", featureBranchName))
 		})
-		err = testTeardown(ctx, p)
-		require.NoError(t, err)
 	}
 }
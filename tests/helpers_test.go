@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/avast/retry-go"
 	git2go "github.com/libgit2/git2go/v33"
@@ -13,6 +15,63 @@ import (
 	"github.com/xenitab/gitops-promotion/pkg/git"
 )
 
+// testCreateRemoteRepository creates a bare repository with the content of testdata/repository
+// on the default branch, to be used as the remote for the fake provider.
+func testCreateRemoteRepository(t *testing.T, defaultBranch string) string {
+	t.Helper()
+
+	remotePath := filepath.Join(t.TempDir(), "remote.git")
+	remote, err := git2go.InitRepository(remotePath, true)
+	require.NoError(t, err)
+	defer remote.Free()
+	err = remote.SetHead(fmt.Sprintf("refs/heads/%s", defaultBranch))
+	require.NoError(t, err)
+
+	path := t.TempDir()
+	repo, err := git2go.InitRepository(path, false)
+	require.NoError(t, err)
+	defer repo.Free()
+	source := filepath.Join("testdata", "repository")
+	err = filepath.Walk(source, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(path, rel), 0755)
+		}
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(path, rel), b, 0600)
+	})
+	require.NoError(t, err)
+
+	idx, err := repo.Index()
+	require.NoError(t, err)
+	err = idx.AddAll([]string{}, git2go.IndexAddDefault, nil)
+	require.NoError(t, err)
+	treeID, err := idx.WriteTree()
+	require.NoError(t, err)
+	tree, err := repo.LookupTree(treeID)
+	require.NoError(t, err)
+	signature := &git2go.Signature{Name: "gitops-promotion", Email: "gitops-promotion@xenit.se", When: time.Now()}
+	refName := fmt.Sprintf("refs/heads/%s", defaultBranch)
+	_, err = repo.CreateCommit(refName, signature, signature, "Initial commit", tree)
+	require.NoError(t, err)
+
+	origin, err := repo.Remotes.Create(git.DefaultRemote, remotePath)
+	require.NoError(t, err)
+	err = origin.Push([]string{refName}, &git2go.PushOptions{})
+	require.NoError(t, err)
+
+	return remotePath
+}
+
 func testCloneRepositoryAndValidateTag(t *testing.T, url, username, password, branchName, group, env, app, tag string) string {
 	t.Helper()
 
@@ -41,7 +100,7 @@ func testCloneRepositoryAndValidateTag(t *testing.T, url, username, password, br
 func testCloneRepository(t *testing.T, url, username, password, path, branchName string) {
 	t.Helper()
 
-	err := git.Clone(url, username, password, path, branchName)
+	err := git.Clone(url, username, password, path, branchName, nil)
 	require.NoError(t, err)
 }
 
@@ -65,6 +124,17 @@ func testGetRepositoryHeadRevision(t *testing.T, repo *git2go.Repository) string
 	return rev
 }
 
+func testGetRepositoryHeadCommit(t *testing.T, repo *git2go.Repository) *git2go.Commit {
+	t.Helper()
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+	commit, err := repo.LookupCommit(head.Target())
+	require.NoError(t, err)
+
+	return commit
+}
+
 func testSetStatus(
 	t *testing.T,
 	ctx context.Context,
@@ -78,20 +148,20 @@ func testSetStatus(
 ) {
 	t.Helper()
 
-	repo, err := git.NewGitProvider(ctx, providerType, url, token)
+	repo, err := git.NewGitProvider(ctx, providerType, url, token, git.ProviderOptions{})
 	require.NoError(t, err)
 
 	err = repo.SetStatus(ctx, revision, group, env, succeeded)
 	require.NoError(t, err)
 }
 
-func testMergePR(t *testing.T, ctx context.Context, providerType git.ProviderType, url, token, branch, revision string) {
+func testMergePR(t *testing.T, ctx context.Context, providerType git.ProviderType, url, token, branch, defaultBranch, revision string) {
 	t.Helper()
 
-	provider, err := git.NewGitProvider(ctx, providerType, url, token)
+	provider, err := git.NewGitProvider(ctx, providerType, url, token, git.ProviderOptions{})
 	require.NoError(t, err)
 
-	pr, err := provider.GetPRWithBranch(ctx, branch, "main")
+	pr, err := provider.GetPRWithBranch(ctx, branch, defaultBranch)
 	require.NoError(t, err)
 
 	err = provider.MergePR(ctx, pr.ID, revision)